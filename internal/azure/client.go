@@ -0,0 +1,189 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	gitrepo "gha-file-sync/internal/git"
+	"gha-file-sync/internal/log"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v7"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v7/git"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v7/location"
+)
+
+// Client for Azure DevOps Repos, cloud or server.
+// The owner of a repository is its project, the organization (or collection) is part of the client URL.
+type Client struct {
+	gitClient      git.Client
+	locationClient location.Client
+
+	organizationURL string
+	token           string
+}
+
+// NewClient for azure devops with a personal access token.
+// organizationURL is https://dev.azure.com/{ORGANIZATION} on cloud, https://{HOST}/{COLLECTION} on server.
+func NewClient(ctx context.Context, pat, organizationURL string) (*Client, error) {
+	organizationURL = strings.TrimSuffix(organizationURL, "/")
+	connection := azuredevops.NewPatConnection(organizationURL, pat)
+	gitClient, err := git.NewClient(ctx, connection)
+	if err != nil {
+		return nil, fmt.Errorf("creating azure devops git client: %v", err)
+	}
+	return &Client{
+		gitClient:       gitClient,
+		locationClient:  location.NewClient(ctx, connection),
+		organizationURL: organizationURL,
+		token:           pat,
+	}, nil
+}
+
+// GetAuthenticatedUser return the display name and the account e-mail of the current authenticated user.
+func (c Client) GetAuthenticatedUser(ctx context.Context) (gitrepo.Identity, error) {
+	connectionData, err := c.locationClient.GetConnectionData(ctx, location.GetConnectionDataArgs{})
+	if err != nil {
+		return gitrepo.Identity{}, fmt.Errorf("getting user: %v", err)
+	}
+	user := connectionData.AuthenticatedUser
+	if user == nil || user.ProviderDisplayName == nil {
+		return gitrepo.Identity{}, fmt.Errorf("retrieved an empty user")
+	}
+	identity := gitrepo.Identity{Name: *user.ProviderDisplayName, Email: accountEmail(user.Properties)}
+	if user.CustomDisplayName != nil && *user.CustomDisplayName != "" {
+		identity.Name = *user.CustomDisplayName
+	}
+	return identity, nil
+}
+
+// accountEmail from the identity properties: {"Account": {"$value": "..."}}.
+// It is empty for service principals and if the account is not an e-mail address.
+func accountEmail(properties any) string {
+	props, ok := properties.(map[string]any)
+	if !ok {
+		return ""
+	}
+	account, ok := props["Account"].(map[string]any)
+	if !ok {
+		return ""
+	}
+	email, _ := account["$value"].(string)
+	if !strings.Contains(email, "@") {
+		return ""
+	}
+	return email
+}
+
+// GetHeadBranchNameByPRNumbers for a given repository as a map. Consider only active PRs.
+func (c Client) GetHeadBranchNameByPRNumbers(ctx context.Context, owner, repoName string) (map[int]string, error) {
+	top := 99
+	prs, err := c.gitClient.GetPullRequests(ctx, git.GetPullRequestsArgs{
+		RepositoryId: &repoName,
+		Project:      &owner,
+		SearchCriteria: &git.GitPullRequestSearchCriteria{
+			Status: &git.PullRequestStatusValues.Active,
+		},
+		Top: &top,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing prs: %v", err)
+	}
+	if prs == nil {
+		return map[int]string{}, nil
+	}
+
+	// log a warning if the number of PR retrieved is the maximum page size
+	if len(*prs) == top {
+		log.Warnf("99 active PRs on this repository, this may make the synchronization to fail")
+	}
+
+	headBranchNameByPRNumbers := make(map[int]string, len(*prs))
+	for _, pr := range *prs {
+		if pr.SourceRefName != nil && pr.PullRequestId != nil {
+			headBranchNameByPRNumbers[*pr.PullRequestId] = strings.TrimPrefix(*pr.SourceRefName, "refs/heads/")
+		}
+	}
+	return headBranchNameByPRNumbers, nil
+}
+
+// CreateOrUpdatePR according to the existingPRNumber parameter.
+// On update, the desc is added to the Pull Request as a comment thread.
+func (c Client) CreateOrUpdatePR(
+	ctx context.Context, existingPRNumber *int,
+	owner, repoName,
+	baseBranch, headBranch,
+	title, desc string,
+) error {
+	if existingPRNumber == nil { // create mode
+		sourceRefName := "refs/heads/" + headBranch
+		targetRefName := "refs/heads/" + baseBranch
+		createdPR, err := c.gitClient.CreatePullRequest(ctx, git.CreatePullRequestArgs{
+			GitPullRequestToCreate: &git.GitPullRequest{
+				Title:         &title,
+				Description:   &desc,
+				SourceRefName: &sourceRefName,
+				TargetRefName: &targetRefName,
+			},
+			RepositoryId: &repoName,
+			Project:      &owner,
+		})
+		if err != nil {
+			return fmt.Errorf("creating PR: %v", err)
+		}
+		if createdPR == nil || createdPR.PullRequestId == nil {
+			return fmt.Errorf("created PR has no id")
+		}
+		log.Infof("PR created: %s", c.prURL(owner, repoName, *createdPR.PullRequestId))
+	} else { // update mode = create a comment thread with the given desc
+		desc = fmt.Sprintf("PR updated with additional changes: %s", desc)
+		_, err := c.gitClient.CreateThread(ctx, git.CreateThreadArgs{
+			CommentThread: &git.GitPullRequestCommentThread{
+				Comments: &[]git.Comment{{
+					Content:     &desc,
+					CommentType: &git.CommentTypeValues.Text,
+				}},
+				Status: &git.CommentThreadStatusValues.Closed,
+			},
+			RepositoryId:  &repoName,
+			PullRequestId: existingPRNumber,
+			Project:       &owner,
+		})
+		if err != nil {
+			return fmt.Errorf("creating comment on PR: %v", err)
+		}
+		log.Infof("PR updated: %s", c.prURL(owner, repoName, *existingPRNumber))
+	}
+	return nil
+}
+
+// GetRepoURL to clone the repository over https.
+func (c Client) GetRepoURL(owner, repoName string) string {
+	return fmt.Sprintf("%s/%s/_git/%s", c.organizationURL, owner, repoName)
+}
+
+// GetSSHRepoURL to clone the repository over ssh.
+// On cloud, the organization is part of the path of the dedicated ssh host.
+func (c Client) GetSSHRepoURL(owner, repoName string) string {
+	orgURL, err := url.Parse(c.organizationURL)
+	if err != nil { // already validated by the configuration
+		return ""
+	}
+	if orgURL.Host == "dev.azure.com" {
+		return fmt.Sprintf("git@ssh.dev.azure.com:v3%s/%s/%s", orgURL.Path, owner, repoName)
+	}
+	return fmt.Sprintf("ssh://%s:22%s/%s/_git/%s", orgURL.Hostname(), orgURL.Path, owner, repoName)
+}
+
+// GitAuth returns the authentication method to use for git operations over https.
+func (c Client) GitAuth() http.AuthMethod {
+	// any non-empty username is accepted with a personal access token
+	return &http.BasicAuth{Username: "pat", Password: c.token}
+}
+
+// prURL for humans.
+func (c Client) prURL(owner, repoName string, id int) string {
+	return fmt.Sprintf("%s/%s/_git/%s/pullrequest/%d", c.organizationURL, owner, repoName, id)
+}
@@ -0,0 +1,318 @@
+package bitbucket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/url"
+	"strings"
+
+	"gha-file-sync/internal/git"
+	"gha-file-sync/internal/log"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// cloudHostURL is the host of Bitbucket Cloud, any other host is considered as a Bitbucket Data Center instance.
+const cloudHostURL = "bitbucket.org"
+
+// Client for Bitbucket Cloud and Bitbucket Data Center (formerly Server).
+// The owner of a repository is the workspace on Bitbucket Cloud and the project key on Bitbucket Data Center.
+type Client struct {
+	httpClient *nethttp.Client
+
+	hostURL  string
+	apiURL   string
+	isCloud  bool
+	username string // optional: if set, the token is used as an app password
+	token    string
+}
+
+// NewClient for bitbucket with authentication configured.
+// With a username, the token is considered as an app password (cloud) or a personal access token (data center)
+// used with basic authentication. Without, it is used as a bearer access token.
+func NewClient(username, token, hostURL string) *Client {
+	c := &Client{
+		httpClient: &nethttp.Client{},
+		hostURL:    hostURL,
+		isCloud:    hostURL == cloudHostURL,
+		username:   username,
+		token:      token,
+	}
+	if c.isCloud {
+		c.apiURL = "https://api.bitbucket.org/2.0"
+	} else {
+		c.apiURL = fmt.Sprintf("https://%s/rest/api/1.0", hostURL)
+	}
+	return c
+}
+
+// GetAuthenticatedUser return the identity of the current authenticated user.
+// The e-mail is empty if the token is not allowed to read it.
+func (c Client) GetAuthenticatedUser(ctx context.Context) (git.Identity, error) {
+	if !c.isCloud {
+		return c.getDataCenterUser(ctx)
+	}
+
+	user := struct {
+		DisplayName string `json:"display_name"`
+		Username    string `json:"username"`
+		Nickname    string `json:"nickname"`
+	}{}
+	if _, err := c.do(ctx, nethttp.MethodGet, "/user", nil, &user); err != nil {
+		return git.Identity{}, fmt.Errorf("getting user: %v", err)
+	}
+	identity := git.Identity{Name: user.DisplayName}
+	for _, name := range []string{user.Username, user.Nickname, c.username} {
+		if identity.Name == "" {
+			identity.Name = name
+		}
+	}
+	if identity.Name == "" {
+		return git.Identity{}, fmt.Errorf("retrieved an empty user")
+	}
+
+	// the e-mail requires the email scope: ignore any error
+	emails := struct {
+		Values []struct {
+			Email     string `json:"email"`
+			IsPrimary bool   `json:"is_primary"`
+		} `json:"values"`
+	}{}
+	if _, err := c.do(ctx, nethttp.MethodGet, "/user/emails", nil, &emails); err == nil {
+		for _, e := range emails.Values {
+			if e.IsPrimary {
+				identity.Email = e.Email
+			}
+		}
+	}
+	return identity, nil
+}
+
+// getDataCenterUser from its profile, the user slug being returned in a header of any response if not configured.
+func (c Client) getDataCenterUser(ctx context.Context) (git.Identity, error) {
+	username := c.username
+	if username == "" {
+		resp, err := c.do(ctx, nethttp.MethodGet, "/application-properties", nil, nil)
+		if err != nil {
+			return git.Identity{}, fmt.Errorf("getting user: %v", err)
+		}
+		username = resp.Header.Get("X-AUSERNAME")
+		if username == "" {
+			return git.Identity{}, fmt.Errorf("retrieved an empty user")
+		}
+	}
+	user := struct {
+		DisplayName  string `json:"displayName"`
+		EmailAddress string `json:"emailAddress"`
+	}{}
+	if _, err := c.do(ctx, nethttp.MethodGet, "/users/"+url.PathEscape(username), nil, &user); err != nil {
+		return git.Identity{}, fmt.Errorf("getting user profile: %v", err)
+	}
+	identity := git.Identity{Name: user.DisplayName, Email: user.EmailAddress}
+	if identity.Name == "" {
+		identity.Name = username
+	}
+	return identity, nil
+}
+
+// GetHeadBranchNameByPRNumbers for a given repository as a map. Consider only opened PRs.
+func (c Client) GetHeadBranchNameByPRNumbers(ctx context.Context, owner, repoName string) (map[int]string, error) {
+	// max page size is 50 on cloud: https://developer.atlassian.com/cloud/bitbucket/rest/intro/#pagination
+	var prs []pullRequest
+	if c.isCloud {
+		page := struct {
+			Values []struct {
+				ID     int `json:"id"`
+				Source struct {
+					Branch struct {
+						Name string `json:"name"`
+					} `json:"branch"`
+				} `json:"source"`
+			} `json:"values"`
+		}{}
+		path := fmt.Sprintf("/repositories/%s/%s/pullrequests?state=OPEN&pagelen=50", url.PathEscape(owner), url.PathEscape(repoName))
+		if _, err := c.do(ctx, nethttp.MethodGet, path, nil, &page); err != nil {
+			return nil, fmt.Errorf("listing prs: %v", err)
+		}
+		for _, v := range page.Values {
+			prs = append(prs, pullRequest{id: v.ID, sourceBranch: v.Source.Branch.Name})
+		}
+	} else {
+		page := struct {
+			Values []struct {
+				ID      int `json:"id"`
+				FromRef struct {
+					DisplayID string `json:"displayId"`
+				} `json:"fromRef"`
+			} `json:"values"`
+		}{}
+		path := fmt.Sprintf("%s/pull-requests?state=OPEN&limit=50", repoPath(owner, repoName))
+		if _, err := c.do(ctx, nethttp.MethodGet, path, nil, &page); err != nil {
+			return nil, fmt.Errorf("listing prs: %v", err)
+		}
+		for _, v := range page.Values {
+			prs = append(prs, pullRequest{id: v.ID, sourceBranch: v.FromRef.DisplayID})
+		}
+	}
+
+	// log a warning if the number of PR retrieved is the maximum page size
+	if len(prs) == 50 { //nolint:gomnd
+		log.Warnf("50 opened PRs on this repository, this may make the synchronization to fail")
+	}
+
+	headBranchNameByPRNumbers := make(map[int]string, len(prs))
+	for _, pr := range prs {
+		if pr.sourceBranch != "" {
+			headBranchNameByPRNumbers[pr.id] = pr.sourceBranch
+		}
+	}
+	return headBranchNameByPRNumbers, nil
+}
+
+// CreateOrUpdatePR according to the existingPRNumber parameter.
+// On update, the desc is added to the Pull Request as a comment.
+func (c Client) CreateOrUpdatePR(
+	ctx context.Context, existingPRNumber *int,
+	owner, repoName,
+	baseBranch, headBranch,
+	title, desc string,
+) error {
+	if existingPRNumber == nil { // create mode
+		var path string
+		var pr any
+		if c.isCloud {
+			path = fmt.Sprintf("/repositories/%s/%s/pullrequests", url.PathEscape(owner), url.PathEscape(repoName))
+			pr = map[string]any{
+				"title":       title,
+				"description": desc,
+				"source":      map[string]any{"branch": map[string]string{"name": headBranch}},
+				"destination": map[string]any{"branch": map[string]string{"name": baseBranch}},
+			}
+		} else {
+			path = fmt.Sprintf("%s/pull-requests", repoPath(owner, repoName))
+			// both branches are in the target repository, not a fork
+			repository := map[string]any{"slug": repoName, "project": map[string]string{"key": owner}}
+			pr = map[string]any{
+				"title":       title,
+				"description": desc,
+				"fromRef":     map[string]any{"id": "refs/heads/" + headBranch, "repository": repository},
+				"toRef":       map[string]any{"id": "refs/heads/" + baseBranch, "repository": repository},
+			}
+		}
+		createdPR := struct {
+			ID int `json:"id"`
+		}{}
+		if _, err := c.do(ctx, nethttp.MethodPost, path, pr, &createdPR); err != nil {
+			return fmt.Errorf("creating PR: %v", err)
+		}
+		log.Infof("PR created: %s", c.prURL(owner, repoName, createdPR.ID))
+	} else { // update mode = create a comment with the given desc
+		desc = fmt.Sprintf("PR updated with additional changes: %s", desc)
+		var path string
+		var comment any
+		if c.isCloud {
+			path = fmt.Sprintf("/repositories/%s/%s/pullrequests/%d/comments", url.PathEscape(owner), url.PathEscape(repoName), *existingPRNumber)
+			comment = map[string]any{"content": map[string]string{"raw": desc}}
+		} else {
+			path = fmt.Sprintf("%s/pull-requests/%d/comments", repoPath(owner, repoName), *existingPRNumber)
+			comment = map[string]string{"text": desc}
+		}
+		if _, err := c.do(ctx, nethttp.MethodPost, path, comment, nil); err != nil {
+			return fmt.Errorf("creating comment on PR: %v", err)
+		}
+		log.Infof("PR updated: %s", c.prURL(owner, repoName, *existingPRNumber))
+	}
+	return nil
+}
+
+// GetRepoURL to clone the repository over https.
+func (c Client) GetRepoURL(owner, repoName string) string {
+	if c.isCloud {
+		return fmt.Sprintf("https://%s/%s/%s.git", c.hostURL, owner, repoName)
+	}
+	return fmt.Sprintf("https://%s/scm/%s/%s.git", c.hostURL, strings.ToLower(owner), repoName)
+}
+
+// GetSSHRepoURL to clone the repository over ssh.
+// Bitbucket Data Center serves ssh on its default port 7999.
+func (c Client) GetSSHRepoURL(owner, repoName string) string {
+	if c.isCloud {
+		return fmt.Sprintf("git@%s:%s/%s.git", c.hostURL, owner, repoName)
+	}
+	return fmt.Sprintf("ssh://git@%s:7999/%s/%s.git", c.hostURL, strings.ToLower(owner), repoName)
+}
+
+// GitAuth returns the authentication method to use for git operations over https.
+func (c Client) GitAuth() http.AuthMethod {
+	switch {
+	case c.username != "": // app password or personal access token with its user
+		return &http.BasicAuth{Username: c.username, Password: c.token}
+	case c.isCloud: // repository, project or workspace access token
+		return &http.BasicAuth{Username: "x-token-auth", Password: c.token}
+	default: // http access token
+		return &http.TokenAuth{Token: c.token}
+	}
+}
+
+type pullRequest struct {
+	id           int
+	sourceBranch string
+}
+
+// do an API request, encoding the body and decoding the response in out if not nil.
+func (c Client) do(ctx context.Context, method, path string, body, out any) (*nethttp.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encoding body: %v", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := nethttp.NewRequestWithContext(ctx, method, c.apiURL+path, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("building request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= nethttp.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024)) //nolint:gomnd
+		return resp, fmt.Errorf("%s %s: %d %s", method, path, resp.StatusCode, msg)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("decoding response: %v", err)
+		}
+	}
+	return resp, nil
+}
+
+// prURL for humans.
+func (c Client) prURL(owner, repoName string, id int) string {
+	if c.isCloud {
+		return fmt.Sprintf("https://%s/%s/%s/pull-requests/%d", c.hostURL, owner, repoName, id)
+	}
+	return fmt.Sprintf("https://%s/projects/%s/repos/%s/pull-requests/%d", c.hostURL, owner, repoName, id)
+}
+
+// repoPath of the data center API.
+func repoPath(projectKey, repoSlug string) string {
+	return fmt.Sprintf("/projects/%s/repos/%s", url.PathEscape(projectKey), url.PathEscape(repoSlug))
+}
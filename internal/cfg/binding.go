@@ -0,0 +1,184 @@
+package cfg
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gha-file-sync/internal/git"
+)
+
+const (
+	// FileModeRegular forces the bound files to be non executable.
+	FileModeRegular = "644"
+	// FileModeExecutable forces the bound files to be executable.
+	FileModeExecutable = "755"
+
+	// CompareExact considers any byte difference as a change: the default.
+	CompareExact = "exact"
+	// CompareWhitespace ignores trailing whitespaces of lines and trailing blank lines.
+	CompareWhitespace = "whitespace"
+	// CompareJSON ignores formatting and key order of JSON files.
+	CompareJSON = "json"
+	// CompareYAML ignores formatting, comments and key order of YAML files.
+	CompareYAML = "yaml"
+
+	// WriteAlways overwrites the target files: the default.
+	WriteAlways = "always"
+	// WriteIfMissing only creates the target files: existing ones are never touched.
+	WriteIfMissing = "if-missing"
+	// WriteIfUnchanged only overwrites the target files matching a version of their source: local changes are kept.
+	WriteIfUnchanged = "if-unchanged-since-last-sync"
+
+	// PatchDiff patches the target files with the unified diff of the source.
+	PatchDiff = "diff"
+	// PatchRegexp patches the target files with the sed-like replacements of the source: s/{REGEXP}/{REPLACEMENT}/.
+	PatchRegexp = "regexp"
+
+	// ConditionExists applies a binding only if the file or directory exists in the target repository.
+	ConditionExists = "if-exists"
+	// ConditionAbsent applies a binding only if the file or directory does not exist in the target repository.
+	ConditionAbsent = "if-absent"
+	// ConditionMatch applies a binding only if a file of the target repository matches the glob pattern.
+	ConditionMatch = "if-match"
+	// ConditionTopic applies a binding only if the target repository has the topic.
+	ConditionTopic = "if-topic"
+	// ConditionLanguage applies a binding only if the main language of the target repository is the given one.
+	ConditionLanguage = "if-language"
+)
+
+// Condition on the target repository for a binding to apply.
+type Condition struct {
+	Kind  string // see Condition* constants
+	Value string
+}
+
+func (c Condition) String() string {
+	return fmt.Sprintf("%s=%s", c.Kind, c.Value)
+}
+
+// FileBinding of a source file or directory to its destination in the synchronized repositories.
+type FileBinding struct {
+	Source  string
+	Dest    string
+	Mode    string // see FileMode* constants, the source file modes are preserved if empty
+	EOL     string // line endings of text files, lf or crlf, unless set by the target .gitattributes, kept if empty
+	Compare string // see Compare* constants, exact if empty
+	Write   string // see Write* constants
+	Patch   string // see Patch* constants, the source patches the existing target files instead of replacing them if set
+
+	Conditions []Condition // all required for the binding to apply
+
+	// source from another repository
+	SourceRepo *Repository // the action repository if nil
+	SourceRef  string      // branch, tag or commit hash, the default branch if empty
+	SourceDir  string      // local clone of the source repository, set once cloned
+}
+
+// SourcePath of the bound file or directory, in the action repository at actionDir or in the source repository clone.
+func (b FileBinding) SourcePath(actionDir string) string {
+	if b.SourceDir != "" {
+		return filepath.Join(b.SourceDir, b.Source)
+	}
+	return filepath.Join(actionDir, b.Source)
+}
+
+func (b FileBinding) String() string {
+	s := fmt.Sprintf("%s -> %s", b.Source, b.Dest)
+	if b.SourceRepo != nil {
+		s = fmt.Sprintf("%s@%s:%s -> %s", b.SourceRepo, b.SourceRef, b.Source, b.Dest)
+	}
+	if b.Mode != "" {
+		s = fmt.Sprintf("%s (mode %s)", s, b.Mode)
+	}
+	if b.EOL != "" {
+		s = fmt.Sprintf("%s (eol %s)", s, b.EOL)
+	}
+	if b.Compare != "" && b.Compare != CompareExact {
+		s = fmt.Sprintf("%s (compare %s)", s, b.Compare)
+	}
+	if b.Patch != "" {
+		s = fmt.Sprintf("%s (patch %s)", s, b.Patch)
+	}
+	if b.Write != "" && b.Write != WriteAlways {
+		s = fmt.Sprintf("%s (write %s)", s, b.Write)
+	}
+	for _, c := range b.Conditions {
+		s = fmt.Sprintf("%s (%s)", s, c)
+	}
+	return s
+}
+
+// ParseFileBinding from a binding entry: {SOURCE}={DEST}[;{OPTION}={VALUE}...].
+// Available options: mode=644|755, eol=lf|crlf, compare=exact|whitespace|json|yaml,
+// write=always|if-missing|if-unchanged-since-last-sync, patch=diff|regexp,
+// from={REPOSITORY}[@{REF}] to take the source from another repository,
+// if-exists, if-absent, if-match, if-topic and if-language to apply it only to some target repositories.
+func ParseFileBinding(entry string) (FileBinding, error) {
+	b := FileBinding{Compare: CompareExact, Write: WriteAlways}
+	paths, optionsStr, _ := strings.Cut(strings.TrimSpace(entry), ";")
+	split := strings.Split(paths, "=")
+	if len(split) != 2 { //nolint:gomnd
+		return b, fmt.Errorf("incorrect binding: %s", entry)
+	}
+	b.Source, b.Dest = split[0], split[1]
+
+	if optionsStr == "" {
+		return b, nil
+	}
+	for _, option := range strings.Split(optionsStr, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		switch key {
+		case "mode":
+			if value != FileModeRegular && value != FileModeExecutable {
+				return b, fmt.Errorf("invalid mode in binding %s: %s or %s expected", entry, FileModeRegular, FileModeExecutable)
+			}
+			b.Mode = value
+		case "eol":
+			if value != git.EOLLF && value != git.EOLCRLF {
+				return b, fmt.Errorf("invalid eol in binding %s: %s or %s expected", entry, git.EOLLF, git.EOLCRLF)
+			}
+			b.EOL = value
+		case "compare":
+			switch value {
+			case CompareExact, CompareWhitespace, CompareJSON, CompareYAML:
+				b.Compare = value
+			default:
+				return b, fmt.Errorf("invalid compare in binding %s: %s, %s, %s or %s expected", entry, CompareExact, CompareWhitespace, CompareJSON, CompareYAML)
+			}
+		case "write":
+			switch value {
+			case WriteAlways, WriteIfMissing, WriteIfUnchanged:
+				b.Write = value
+			default:
+				return b, fmt.Errorf("invalid write in binding %s: %s, %s or %s expected", entry, WriteAlways, WriteIfMissing, WriteIfUnchanged)
+			}
+		case "patch":
+			if value != PatchDiff && value != PatchRegexp {
+				return b, fmt.Errorf("invalid patch in binding %s: %s or %s expected", entry, PatchDiff, PatchRegexp)
+			}
+			b.Patch = value
+		case "from":
+			repoEntry, ref, _ := strings.Cut(value, "@")
+			repo, err := ParseRepository(repoEntry)
+			if err != nil {
+				return b, fmt.Errorf("invalid source repository in binding %s: %v", entry, err)
+			}
+			b.SourceRepo, b.SourceRef = &repo, ref
+		case ConditionExists, ConditionAbsent, ConditionTopic, ConditionLanguage:
+			if value == "" {
+				return b, fmt.Errorf("invalid %s in binding %s: empty value", key, entry)
+			}
+			b.Conditions = append(b.Conditions, Condition{Kind: key, Value: value})
+		case ConditionMatch:
+			if _, err := path.Match(value, ""); value == "" || err != nil {
+				return b, fmt.Errorf("invalid %s in binding %s: glob pattern expected", key, entry)
+			}
+			b.Conditions = append(b.Conditions, Condition{Kind: key, Value: value})
+		default:
+			return b, fmt.Errorf("unknown option in binding %s: %s", entry, key)
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,111 @@
+package cfg
+
+import (
+	"reflect"
+	"testing"
+
+	"gha-file-sync/internal/provider"
+)
+
+func TestParseFileBinding(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    FileBinding
+		wantErr bool
+	}{
+		{entry: "a.txt=b.txt", want: FileBinding{Source: "a.txt", Dest: "b.txt", Compare: CompareExact, Write: WriteAlways}},
+		{entry: " dir/=dest/ ", want: FileBinding{Source: "dir/", Dest: "dest/", Compare: CompareExact, Write: WriteAlways}},
+		{
+			entry: "run.sh=run.sh;mode=755;eol=crlf;compare=whitespace",
+			want:  FileBinding{Source: "run.sh", Dest: "run.sh", Mode: FileModeExecutable, EOL: "crlf", Compare: CompareWhitespace, Write: WriteAlways},
+		},
+		{
+			entry: "a.yml=a.yml; compare=yaml ; write=if-missing",
+			want:  FileBinding{Source: "a.yml", Dest: "a.yml", Compare: CompareYAML, Write: WriteIfMissing},
+		},
+		{
+			entry: "fix.diff=Makefile;patch=diff",
+			want:  FileBinding{Source: "fix.diff", Dest: "Makefile", Compare: CompareExact, Write: WriteAlways, Patch: PatchDiff},
+		},
+		{
+			entry: "ci.yml=ci.yml;from=gitlab:group/templates@v3",
+			want: FileBinding{
+				Source: "ci.yml", Dest: "ci.yml", Compare: CompareExact, Write: WriteAlways,
+				SourceRepo: &Repository{Provider: provider.GitLab, Owner: "group", Name: "templates"}, SourceRef: "v3",
+			},
+		},
+		{
+			entry: "ci.yml=ci.yml;from=org/templates",
+			want: FileBinding{
+				Source: "ci.yml", Dest: "ci.yml", Compare: CompareExact, Write: WriteAlways,
+				SourceRepo: &Repository{Provider: provider.GitHub, Owner: "org", Name: "templates"},
+			},
+		},
+		{
+			entry: "lint.yml=lint.yml;if-exists=go.mod;if-absent=vendor;if-match=*.go;if-topic=service;if-language=go",
+			want: FileBinding{
+				Source: "lint.yml", Dest: "lint.yml", Compare: CompareExact, Write: WriteAlways,
+				Conditions: []Condition{
+					{Kind: ConditionExists, Value: "go.mod"},
+					{Kind: ConditionAbsent, Value: "vendor"},
+					{Kind: ConditionMatch, Value: "*.go"},
+					{Kind: ConditionTopic, Value: "service"},
+					{Kind: ConditionLanguage, Value: "go"},
+				},
+			},
+		},
+		{entry: "a.txt", wantErr: true},
+		{entry: "a=b=c", wantErr: true},
+		{entry: "a=b;mode=777", wantErr: true},
+		{entry: "a=b;eol=cr", wantErr: true},
+		{entry: "a=b;compare=xml", wantErr: true},
+		{entry: "a=b;write=never", wantErr: true},
+		{entry: "a=b;patch=sed", wantErr: true},
+		{entry: "a=b;from=templates", wantErr: true},
+		{entry: "a=b;if-exists=", wantErr: true},
+		{entry: "a=b;if-match=[", wantErr: true},
+		{entry: "a=b;unknown=x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := ParseFileBinding(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileBindingString(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  string
+	}{
+		{entry: "a=b", want: "a -> b"},
+		{entry: "a=b;compare=exact;write=always", want: "a -> b"},
+		{entry: "a=b;mode=644;compare=json", want: "a -> b (mode 644) (compare json)"},
+		{entry: "a=b;from=org/repo@main;if-topic=go", want: "github:org/repo@main:a -> b (if-topic=go)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			b, err := ParseFileBinding(tt.entry)
+			if err != nil {
+				t.Fatalf("parsing %s: %v", tt.entry, err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileBindingStringDefaults(t *testing.T) {
+	// bindings built without parsing: an empty compare is exact, an empty write is always
+	b := FileBinding{Source: "a", Dest: "b"}
+	if got, want := b.String(), "a -> b"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -2,21 +2,107 @@ package cfg
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 
 	"gha-file-sync/internal/log"
+	"gha-file-sync/internal/provider"
+)
+
+const (
+	// SyncModePullRequest pushes a sync branch and opens or updates a pull request: the default.
+	SyncModePullRequest = "pull-request"
+	// SyncModePush only pushes a sync branch, without any hosting api call.
+	SyncModePush = "push"
+	// SyncModeDirect commits on the base branch, without any hosting api call.
+	SyncModeDirect = "direct"
+
+	// SyncEngineClone clones repositories and pushes local commits: the default.
+	SyncEngineClone = "clone"
+	// SyncEngineAPI reads and commits through the provider api without cloning: github only.
+	SyncEngineAPI = "api"
+
+	// GitTransportHTTPS clones and pushes over https with the provider token: the default.
+	GitTransportHTTPS = "https"
+	// GitTransportSSH clones and pushes over ssh with deploy keys, a private key or an ssh agent.
+	GitTransportSSH = "ssh"
+
+	// CommitSigningNone does not sign commits: the default.
+	CommitSigningNone = "none"
+	// CommitSigningGPG signs commits with a gpg private key.
+	CommitSigningGPG = "gpg"
+	// CommitSigningSSH signs commits with an ssh private key.
+	CommitSigningSSH = "ssh"
+	// CommitSigningAPI creates commits through the provider api, which signs them: github only.
+	CommitSigningAPI = "api"
 )
 
 type Config struct {
-	RepositoryNames []string
-	FilesBindings   map[string]string
+	Repositories        []Repository
+	RepositorySelectors []RepositorySelector // github repositories to discover, added to Repositories
+	FilesBindings       []FileBinding
 
 	IsDryRun bool
 
-	GithubToken string
-	GithubURL   string
+	SyncMode          string // see SyncMode* constants
+	PushBranch        string // push mode only: fixed branch to push to instead of a sync branch
+	DirectPushRetries int    // direct mode or fixed push branch: number of re-clones if the branch has moved
+	SyncEngine        string // see SyncEngine* constants
+	CloneDepth        int    // number of commits cloned per branch, full history if 0
+	SparseCheckout    bool   // check out only the destinations of the bindings
+	CloneCacheDir     string // where clones are kept across runs, disabled if empty
+	CloneCacheMaxSize int64  // in bytes, least recently used clones are evicted above it, unlimited if 0
+
+	GithubToken     string
+	GithubURL       string
+	GithubAPIURL    string // empty for github.com
+	GithubUploadURL string // empty for github.com
+
+	// github app authentication - used instead of the token when GithubAppID is set
+	GithubAppID             int64
+	GithubAppInstallationID int64 // 0 means the installation is discovered per repository owner
+	GithubAppPrivateKey     string
+
+	GitlabToken string
+	GitlabURL   string
+
+	GiteaToken string
+	GiteaURL   string
+
+	BitbucketUsername string // optional: the token is then an app password
+	BitbucketToken    string
+	BitbucketURL      string // bitbucket.org for Bitbucket Cloud, any other host for Bitbucket Data Center
+
+	AzureDevOpsToken string
+	AzureDevOpsURL   string // organization or collection URL
+
+	// plain git host, without api
+	GitURL        string
+	GitUsername   string
+	GitPassword   string
+	GitAuthorName string
+
+	// git transport
+	GitTransport            string            // see GitTransport* constants
+	SSHPrivateKey           string            // path or content, the ssh agent is used if empty
+	SSHPrivateKeyPassphrase string            // optional
+	SSHDeployKeys           map[string]string // private key path by repository full name, prevails on SSHPrivateKey
+	SSHKnownHosts           []string          // known_hosts files, default ones are used if empty
+
+	// commit signing
+	CommitSigning              string // see CommitSigning* constants
+	CommitSigningKey           string // path or content, required for gpg and ssh signing
+	CommitSigningKeyPassphrase string // optional
+
+	// commit identity: overrides of the authenticated user identity, the committer defaults to the author
+	CommitAuthorName     string
+	CommitAuthorEmail    string
+	CommitCommitterName  string
+	CommitCommitterEmail string
+	CommitSignOff        bool // add a Signed-off-by trailer for the author
+	CommitCoAuthors      bool // add Co-authored-by trailers for the authors of the source commits
 
 	CommitMessage        string
 	PRTitle              string
@@ -24,12 +110,19 @@ type Config struct {
 
 	Workspace      string // where the repository should be cloned
 	FileSourcePath string // where the source file are stored - set to current dir
+	SourceRef      string // branch, tag or commit of the source repository to take files from, the working directory if empty
+	SourceCommit   string // commit hash SourceRef resolves to, set once the source is exported
+
+	TargetOptIn bool // repositories are only synchronized if their target config enables it
 }
 
 // InitConfig based on env variables.
 func InitConfig() (c *Config, err error) { //nolint:cyclop
 	c = new(Config)
-	if c.RepositoryNames, err = getRepositoryNames(); err != nil {
+	if c.RepositorySelectors, err = getRepositorySelectors(); err != nil {
+		return c, err
+	}
+	if c.Repositories, err = getRepositories(len(c.RepositorySelectors) > 0); err != nil {
 		return c, err
 	}
 	if c.FilesBindings, err = getFilesBindings(); err != nil {
@@ -38,12 +131,78 @@ func InitConfig() (c *Config, err error) { //nolint:cyclop
 	if c.IsDryRun, err = getDryRun(); err != nil {
 		return c, err
 	}
-	if c.GithubToken, err = getGithubToken(); err != nil {
+	if c.SyncMode, err = getSyncMode(c.Repositories); err != nil {
+		return c, err
+	}
+	c.PushBranch = os.Getenv("PUSH_BRANCH")
+	if c.DirectPushRetries, err = getDirectPushRetries(); err != nil {
+		return c, err
+	}
+	if c.GithubAppID, c.GithubAppInstallationID, c.GithubAppPrivateKey, err = getGithubApp(); err != nil {
+		return c, err
+	}
+	// the selectors discover github repositories
+	isGithubTargeted := hasProvider(c.Repositories, provider.GitHub) || len(c.RepositorySelectors) > 0
+	if c.GithubToken, err = getGithubToken(c.GithubAppID == 0 && isGithubTargeted); err != nil {
+		return c, err
+	}
+	if c.GitlabToken, c.GitlabURL, err = getGitlab(c.Repositories); err != nil {
+		return c, err
+	}
+	if c.GiteaToken, c.GiteaURL, err = getGitea(c.Repositories); err != nil {
+		return c, err
+	}
+	if c.BitbucketUsername, c.BitbucketToken, c.BitbucketURL, err = getBitbucket(c.Repositories); err != nil {
+		return c, err
+	}
+	if c.AzureDevOpsToken, c.AzureDevOpsURL, err = getAzureDevOps(c.Repositories); err != nil {
+		return c, err
+	}
+	if c.GitURL, c.GitUsername, c.GitPassword, c.GitAuthorName, err = getPlainGit(c.Repositories); err != nil {
 		return c, err
 	}
 	if c.GithubURL, err = getGithubURL(); err != nil {
 		return c, err
 	}
+	if c.GithubAPIURL, c.GithubUploadURL, err = getGithubAPIURLs(c.GithubURL); err != nil {
+		return c, err
+	}
+	if c.GitTransport, err = getGitTransport(); err != nil {
+		return c, err
+	}
+	c.SSHPrivateKey = os.Getenv("SSH_PRIVATE_KEY")
+	c.SSHPrivateKeyPassphrase = os.Getenv("SSH_PRIVATE_KEY_PASSPHRASE")
+	if c.SSHDeployKeys, err = getSSHDeployKeys(); err != nil {
+		return c, err
+	}
+	c.SSHKnownHosts = getSSHKnownHosts()
+	if c.CommitSigning, c.CommitSigningKey, err = getCommitSigning(c.Repositories); err != nil {
+		return c, err
+	}
+	c.CommitSigningKeyPassphrase = os.Getenv("COMMIT_SIGNING_KEY_PASSPHRASE")
+	if c.SyncEngine, err = getSyncEngine(c.Repositories, c.CommitSigning); err != nil {
+		return c, err
+	}
+	if c.CloneDepth, err = getCloneDepth(); err != nil {
+		return c, err
+	}
+	if c.SparseCheckout, err = getSparseCheckout(); err != nil {
+		return c, err
+	}
+	c.CloneCacheDir = os.Getenv("CLONE_CACHE_DIR")
+	if c.CloneCacheMaxSize, err = getCloneCacheMaxSize(); err != nil {
+		return c, err
+	}
+	c.CommitAuthorName = os.Getenv("COMMIT_AUTHOR_NAME")
+	c.CommitAuthorEmail = os.Getenv("COMMIT_AUTHOR_EMAIL")
+	c.CommitCommitterName = os.Getenv("COMMIT_COMMITTER_NAME")
+	c.CommitCommitterEmail = os.Getenv("COMMIT_COMMITTER_EMAIL")
+	if c.CommitSignOff, err = getOptionalBool("COMMIT_SIGN_OFF"); err != nil {
+		return c, err
+	}
+	if c.CommitCoAuthors, err = getOptionalBool("COMMIT_CO_AUTHORS"); err != nil {
+		return c, err
+	}
 	if c.CommitMessage, err = getCommitMessage(); err != nil {
 		return c, err
 	}
@@ -59,36 +218,88 @@ func InitConfig() (c *Config, err error) { //nolint:cyclop
 	if c.FileSourcePath, err = os.Getwd(); err != nil {
 		return c, err
 	}
+	c.SourceRef = os.Getenv("SOURCE_REF")
+	if c.TargetOptIn, err = getOptionalBool("TARGET_OPT_IN"); err != nil {
+		return c, err
+	}
 	return c, nil
 }
 
 // Print the current configuration.
 func (c *Config) Print() {
 	repoNamesStr := ""
-	for _, rn := range c.RepositoryNames {
-		repoNamesStr = fmt.Sprintf("%s\t\t%s\n", repoNamesStr, rn)
+	for _, r := range c.Repositories {
+		repoNamesStr = fmt.Sprintf("%s\t\t%s\n", repoNamesStr, r)
+	}
+	selectorsStr := ""
+	for _, s := range c.RepositorySelectors {
+		selectorsStr = fmt.Sprintf("%s\t\t%s\n", selectorsStr, s)
 	}
 	fileBindingsStr := ""
-	for src, dest := range c.FilesBindings {
-		fileBindingsStr = fmt.Sprintf("%s\t\t%s -> %s\n", fileBindingsStr, src, dest)
+	for _, b := range c.FilesBindings {
+		fileBindingsStr = fmt.Sprintf("%s\t\t%s\n", fileBindingsStr, b)
 	}
 	configStr := fmt.Sprintln(
 		"\tRepositories:\n", repoNamesStr,
+		"\tRepository selectors:\n", selectorsStr,
 		"\tFiles bindings:\n", fileBindingsStr,
 		"\tDry Run:", c.IsDryRun,
+		"\n\tSync mode: ", c.SyncMode,
+		"\n\tPush branch: ", c.PushBranch,
+		"\n\tDirect push retries: ", c.DirectPushRetries,
+		"\n\tSync engine: ", c.SyncEngine,
+		"\n\tClone depth: ", c.CloneDepth,
+		"\n\tSparse checkout: ", c.SparseCheckout,
+		"\n\tClone cache dir: ", c.CloneCacheDir,
+		"\n\tClone cache max size: ", c.CloneCacheMaxSize,
 		"\n\tGitHub token set?", (c.GithubToken != ""),
+		"\n\tGitHub app ID: ", c.GithubAppID,
+		"\n\tGitHub app installation ID: ", c.GithubAppInstallationID,
+		"\n\tGitHub app private key set?", (c.GithubAppPrivateKey != ""),
 		"\n\tGithub host URL: ", c.GithubURL,
+		"\n\tGithub API URL: ", c.GithubAPIURL,
+		"\n\tGithub upload URL: ", c.GithubUploadURL,
+		"\n\tGitLab token set?", (c.GitlabToken != ""),
+		"\n\tGitLab host URL: ", c.GitlabURL,
+		"\n\tGitea token set?", (c.GiteaToken != ""),
+		"\n\tGitea host URL: ", c.GiteaURL,
+		"\n\tBitbucket username: ", c.BitbucketUsername,
+		"\n\tBitbucket token set?", (c.BitbucketToken != ""),
+		"\n\tBitbucket host URL: ", c.BitbucketURL,
+		"\n\tAzure DevOps token set?", (c.AzureDevOpsToken != ""),
+		"\n\tAzure DevOps organization URL: ", c.AzureDevOpsURL,
+		"\n\tGit host URL: ", c.GitURL,
+		"\n\tGit username: ", c.GitUsername,
+		"\n\tGit author name: ", c.GitAuthorName,
+		"\n\tGit transport: ", c.GitTransport,
+		"\n\tSSH private key set?", (c.SSHPrivateKey != ""),
+		"\n\tSSH deploy keys: ", len(c.SSHDeployKeys),
+		"\n\tSSH known hosts: ", c.SSHKnownHosts,
+		"\n\tCommit signing: ", c.CommitSigning,
+		"\n\tCommit signing key set?", (c.CommitSigningKey != ""),
+		"\n\tCommit author name: ", c.CommitAuthorName,
+		"\n\tCommit author email: ", c.CommitAuthorEmail,
+		"\n\tCommit committer name: ", c.CommitCommitterName,
+		"\n\tCommit committer email: ", c.CommitCommitterEmail,
+		"\n\tCommit sign off: ", c.CommitSignOff,
+		"\n\tCommit co-authors: ", c.CommitCoAuthors,
 		"\n\tCommit message: ", c.CommitMessage,
 		"\n\tFile sync branch regexp: ", c.FileSyncBranchRegexp,
 		"\n\tWorkspace: ", c.Workspace,
 		"\n\tFile Source Path: ", c.FileSourcePath,
+		"\n\tSource ref: ", c.SourceRef,
+		"\n\tTarget opt-in: ", c.TargetOptIn,
 	)
 	fmt.Println(configStr)
 }
 
-func getRepositoryNames() ([]string, error) {
+// getRepositories listed by name: they are only optional with selectors.
+func getRepositories(hasSelectors bool) ([]Repository, error) {
 	// get the raw list from env
 	repoNamesStr := os.Getenv("REPOSITORIES")
+	if repoNamesStr == "" && hasSelectors {
+		return nil, nil
+	}
 	if repoNamesStr == "" {
 		return nil, fmt.Errorf("REPOSITORIES is empty but required")
 	}
@@ -97,15 +308,34 @@ func getRepositoryNames() ([]string, error) {
 	// split by \n
 	repoNames := strings.Split(repoNamesStr, "\n")
 
+	repos := make([]Repository, 0, len(repoNames))
 	for _, name := range repoNames {
-		if len(strings.Split(name, "/")) != 2 { //nolint:gomnd
-			return nil, fmt.Errorf("invalid repo name: %s {OWNER}/{NAME} expected", name)
+		repo, err := ParseRepository(name)
+		if err != nil {
+			return nil, err
 		}
+		repos = append(repos, repo)
 	}
-	return repoNames, nil
+	return repos, nil
 }
 
-func getFilesBindings() (map[string]string, error) {
+func getRepositorySelectors() ([]RepositorySelector, error) {
+	selectorsStr := strings.TrimSpace(os.Getenv("REPOSITORY_SELECTORS"))
+	if selectorsStr == "" {
+		return nil, nil
+	}
+	selectors := []RepositorySelector{}
+	for _, entry := range strings.Split(selectorsStr, "\n") {
+		selector, err := ParseRepositorySelector(entry)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+func getFilesBindings() ([]FileBinding, error) {
 	// get the raw list from env
 	filesBindingsStr := os.Getenv("FILES_BINDINGS")
 	if filesBindingsStr == "" {
@@ -116,14 +346,13 @@ func getFilesBindings() (map[string]string, error) {
 	// split by \n
 	fileBindingsList := strings.Split(filesBindingsStr, "\n")
 
-	filesBindings := make(map[string]string, len(fileBindingsList))
-	// split each binding by `=` to build the binding map
+	filesBindings := make([]FileBinding, 0, len(fileBindingsList))
 	for _, fileBindingStr := range fileBindingsList {
-		split := strings.Split(fileBindingStr, "=")
-		if len(split) != 2 { //nolint:gomnd
-			return nil, fmt.Errorf("incorrect binding: %s", fileBindingStr)
+		binding, err := ParseFileBinding(fileBindingStr)
+		if err != nil {
+			return nil, err
 		}
-		filesBindings[split[0]] = split[1]
+		filesBindings = append(filesBindings, binding)
 	}
 
 	// error if no files bindings have been found
@@ -143,14 +372,121 @@ func getDryRun() (bool, error) {
 	return strconv.ParseBool(isDryRunStr)
 }
 
-func getGithubToken() (string, error) {
+// getOptionalBool from the given env var, false if empty.
+func getOptionalBool(name string) (bool, error) {
+	boolStr := os.Getenv(name)
+	if boolStr == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(boolStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return b, nil
+}
+
+func getSyncMode(repos []Repository) (string, error) {
+	syncMode := os.Getenv("SYNC_MODE")
+	switch syncMode {
+	case "":
+		log.Infof("SYNC_MODE empty: set to default value")
+		syncMode = SyncModePullRequest
+	case SyncModePullRequest, SyncModePush, SyncModeDirect:
+	default:
+		return "", fmt.Errorf("invalid SYNC_MODE: %s", syncMode)
+	}
+	// plain git hosts have no api to manage pull requests
+	if syncMode == SyncModePullRequest && hasProvider(repos, provider.Git) {
+		return "", fmt.Errorf("SYNC_MODE %s is not supported by git repositories", syncMode)
+	}
+	return syncMode, nil
+}
+
+func getDirectPushRetries() (int, error) {
+	retriesStr := os.Getenv("DIRECT_PUSH_RETRIES")
+	// default is 3
+	if retriesStr == "" {
+		return 3, nil //nolint:gomnd
+	}
+	retries, err := strconv.Atoi(retriesStr)
+	if err != nil || retries < 0 {
+		return 0, fmt.Errorf("invalid DIRECT_PUSH_RETRIES: %s", retriesStr)
+	}
+	return retries, nil
+}
+
+func getCloneDepth() (int, error) {
+	depthStr := os.Getenv("CLONE_DEPTH")
+	// default is 1: only the last commit is needed to compare and commit
+	if depthStr == "" {
+		return 1, nil
+	}
+	depth, err := strconv.Atoi(depthStr)
+	if err != nil || depth < 0 {
+		return 0, fmt.Errorf("invalid CLONE_DEPTH: %s", depthStr)
+	}
+	return depth, nil
+}
+
+func getSparseCheckout() (bool, error) {
+	sparseCheckoutStr := os.Getenv("SPARSE_CHECKOUT")
+	// default is true
+	if sparseCheckoutStr == "" {
+		return true, nil
+	}
+	sparseCheckout, err := strconv.ParseBool(sparseCheckoutStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid SPARSE_CHECKOUT: %v", err)
+	}
+	return sparseCheckout, nil
+}
+
+func getCloneCacheMaxSize() (int64, error) {
+	maxSizeStr := os.Getenv("CLONE_CACHE_MAX_SIZE_MB")
+	// default is unlimited
+	if maxSizeStr == "" {
+		return 0, nil
+	}
+	maxSizeMB, err := strconv.ParseInt(maxSizeStr, 10, 64)
+	if err != nil || maxSizeMB < 0 {
+		return 0, fmt.Errorf("invalid CLONE_CACHE_MAX_SIZE_MB: %s", maxSizeStr)
+	}
+	return maxSizeMB * 1024 * 1024, nil //nolint:gomnd
+}
+
+func getGithubToken(isRequired bool) (string, error) {
 	githubToken := os.Getenv("GITHUB_TOKEN")
-	if githubToken == "" {
+	// the token is optional when a github app is used or when no github repository is targeted
+	if githubToken == "" && isRequired {
 		return "", fmt.Errorf("GITHUB_TOKEN is empty but required")
 	}
 	return githubToken, nil
 }
 
+func getGithubApp() (appID, installationID int64, privateKey string, err error) {
+	appIDStr := os.Getenv("GITHUB_APP_ID")
+	// no github app configured
+	if appIDStr == "" {
+		return 0, 0, "", nil
+	}
+	if appID, err = strconv.ParseInt(appIDStr, 10, 64); err != nil {
+		return 0, 0, "", fmt.Errorf("invalid GITHUB_APP_ID: %v", err)
+	}
+
+	// installation id is optional: discovered per owner if empty
+	if installationIDStr := os.Getenv("GITHUB_APP_INSTALLATION_ID"); installationIDStr != "" {
+		if installationID, err = strconv.ParseInt(installationIDStr, 10, 64); err != nil {
+			return 0, 0, "", fmt.Errorf("invalid GITHUB_APP_INSTALLATION_ID: %v", err)
+		}
+	}
+
+	privateKey = os.Getenv("GITHUB_APP_PRIVATE_KEY")
+	if privateKey == "" {
+		return 0, 0, "", fmt.Errorf("GITHUB_APP_PRIVATE_KEY is empty but required when GITHUB_APP_ID is set")
+	}
+	return appID, installationID, privateKey, nil
+}
+
 func getGithubURL() (string, error) {
 	githubURL := os.Getenv("GITHUB_URL")
 	if githubURL == "" {
@@ -159,6 +495,212 @@ func getGithubURL() (string, error) {
 	return githubURL, nil
 }
 
+// publicGithubAPIURL of github.com.
+const publicGithubAPIURL = "https://api.github.com"
+
+// getGithubAPIURLs returns the REST API and upload URLs to use.
+// They are empty for github.com, otherwise they are derived from the GitHub Enterprise Server host
+// unless explicitly configured.
+func getGithubAPIURLs(githubURL string) (apiURL, uploadURL string, err error) {
+	apiURL = os.Getenv("GITHUB_API_URL")
+	uploadURL = os.Getenv("GITHUB_UPLOAD_URL")
+	// runners always set GITHUB_API_URL, to the public api on github.com
+	if strings.TrimSuffix(apiURL, "/") == publicGithubAPIURL {
+		apiURL = ""
+	}
+	if githubURL == "github.com" && apiURL == "" {
+		return "", "", nil
+	}
+	if apiURL == "" {
+		apiURL = fmt.Sprintf("https://%s/api/v3/", githubURL)
+	}
+	if uploadURL == "" {
+		uploadURL = fmt.Sprintf("https://%s/api/uploads/", githubURL)
+	}
+	if _, err := url.Parse(apiURL); err != nil {
+		return "", "", fmt.Errorf("invalid GITHUB_API_URL: %v", err)
+	}
+	if _, err := url.Parse(uploadURL); err != nil {
+		return "", "", fmt.Errorf("invalid GITHUB_UPLOAD_URL: %v", err)
+	}
+	return apiURL, uploadURL, nil
+}
+
+// getGitlab configuration, only required if a gitlab repository is targeted.
+func getGitlab(repos []Repository) (token, hostURL string, err error) {
+	token = os.Getenv("GITLAB_TOKEN")
+	hostURL = os.Getenv("GITLAB_URL")
+	if hostURL == "" {
+		hostURL = "gitlab.com"
+	}
+	if token == "" && hasProvider(repos, provider.GitLab) {
+		return "", "", fmt.Errorf("GITLAB_TOKEN is empty but required for gitlab repositories")
+	}
+	return token, hostURL, nil
+}
+
+// getGitea configuration, only required if a gitea repository is targeted.
+func getGitea(repos []Repository) (token, hostURL string, err error) {
+	token = os.Getenv("GITEA_TOKEN")
+	hostURL = os.Getenv("GITEA_URL")
+	if !hasProvider(repos, provider.Gitea) {
+		return token, hostURL, nil
+	}
+	if token == "" {
+		return "", "", fmt.Errorf("GITEA_TOKEN is empty but required for gitea repositories")
+	}
+	// there is no public default instance
+	if hostURL == "" {
+		return "", "", fmt.Errorf("GITEA_URL is empty but required for gitea repositories")
+	}
+	return token, hostURL, nil
+}
+
+// getBitbucket configuration, only required if a bitbucket repository is targeted.
+func getBitbucket(repos []Repository) (username, token, hostURL string, err error) {
+	username = os.Getenv("BITBUCKET_USERNAME")
+	token = os.Getenv("BITBUCKET_TOKEN")
+	hostURL = os.Getenv("BITBUCKET_URL")
+	if hostURL == "" {
+		hostURL = "bitbucket.org"
+	}
+	if token == "" && hasProvider(repos, provider.Bitbucket) {
+		return "", "", "", fmt.Errorf("BITBUCKET_TOKEN is empty but required for bitbucket repositories")
+	}
+	return username, token, hostURL, nil
+}
+
+// getAzureDevOps configuration, only required if an azure devops repository is targeted.
+func getAzureDevOps(repos []Repository) (token, organizationURL string, err error) {
+	token = os.Getenv("AZURE_DEVOPS_TOKEN")
+	organizationURL = os.Getenv("AZURE_DEVOPS_URL")
+	if !hasProvider(repos, provider.Azure) {
+		return token, organizationURL, nil
+	}
+	if token == "" {
+		return "", "", fmt.Errorf("AZURE_DEVOPS_TOKEN is empty but required for azure devops repositories")
+	}
+	if organizationURL == "" {
+		return "", "", fmt.Errorf("AZURE_DEVOPS_URL is empty but required for azure devops repositories")
+	}
+	if _, err := url.Parse(organizationURL); err != nil {
+		return "", "", fmt.Errorf("invalid AZURE_DEVOPS_URL: %v", err)
+	}
+	return token, organizationURL, nil
+}
+
+// getPlainGit configuration, only required if a plain git repository is targeted.
+// Credentials are optional.
+func getPlainGit(repos []Repository) (hostURL, username, password, authorName string, err error) {
+	hostURL = os.Getenv("GIT_URL")
+	username = os.Getenv("GIT_USERNAME")
+	password = os.Getenv("GIT_PASSWORD")
+	authorName = os.Getenv("GIT_AUTHOR_NAME")
+	if authorName == "" {
+		authorName = "gha-file-sync"
+	}
+	if hostURL == "" && hasProvider(repos, provider.Git) {
+		return "", "", "", "", fmt.Errorf("GIT_URL is empty but required for git repositories")
+	}
+	return hostURL, username, password, authorName, nil
+}
+
+func hasProvider(repos []Repository, kind provider.Kind) bool {
+	for _, r := range repos {
+		if r.Provider == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func getGitTransport() (string, error) {
+	gitTransport := os.Getenv("GIT_TRANSPORT")
+	switch gitTransport {
+	case "":
+		return GitTransportHTTPS, nil
+	case GitTransportHTTPS, GitTransportSSH:
+		return gitTransport, nil
+	default:
+		return "", fmt.Errorf("invalid GIT_TRANSPORT: %s", gitTransport)
+	}
+}
+
+func getSSHDeployKeys() (map[string]string, error) {
+	// get the raw list from env - optional
+	deployKeysStr := strings.TrimSpace(os.Getenv("SSH_DEPLOY_KEYS"))
+	if deployKeysStr == "" {
+		return map[string]string{}, nil
+	}
+	// split by \n
+	deployKeysList := strings.Split(deployKeysStr, "\n")
+
+	deployKeys := make(map[string]string, len(deployKeysList))
+	// split each deploy key by `=` to build the map: {OWNER}/{NAME}={KEY PATH}
+	for _, deployKeyStr := range deployKeysList {
+		repoFullName, keyPath, found := strings.Cut(strings.TrimSpace(deployKeyStr), "=")
+		if !found || repoFullName == "" || keyPath == "" {
+			return nil, fmt.Errorf("incorrect deploy key: %s", deployKeyStr)
+		}
+		deployKeys[repoFullName] = keyPath
+	}
+	return deployKeys, nil
+}
+
+func getSSHKnownHosts() []string {
+	knownHostsStr := strings.TrimSpace(os.Getenv("SSH_KNOWN_HOSTS"))
+	if knownHostsStr == "" {
+		return nil
+	}
+	return strings.Split(knownHostsStr, "\n")
+}
+
+func getSyncEngine(repos []Repository, commitSigning string) (string, error) {
+	syncEngine := os.Getenv("SYNC_ENGINE")
+	switch syncEngine {
+	case "", SyncEngineClone:
+		return SyncEngineClone, nil
+	case SyncEngineAPI:
+		// only github exposes the needed git data api
+		for _, r := range repos {
+			if r.Provider != provider.GitHub {
+				return "", fmt.Errorf("%s sync engine is only supported on github repositories: %s", syncEngine, r)
+			}
+		}
+		// commits are created by github: they cannot be signed locally
+		if commitSigning == CommitSigningGPG || commitSigning == CommitSigningSSH {
+			return "", fmt.Errorf("%s commit signing is not supported with the %s sync engine", commitSigning, syncEngine)
+		}
+		return syncEngine, nil
+	default:
+		return "", fmt.Errorf("invalid SYNC_ENGINE: %s", syncEngine)
+	}
+}
+
+func getCommitSigning(repos []Repository) (string, string, error) {
+	commitSigning := os.Getenv("COMMIT_SIGNING")
+	commitSigningKey := os.Getenv("COMMIT_SIGNING_KEY")
+	switch commitSigning {
+	case "", CommitSigningNone:
+		return CommitSigningNone, "", nil
+	case CommitSigningGPG, CommitSigningSSH:
+		if commitSigningKey == "" {
+			return "", "", fmt.Errorf("COMMIT_SIGNING_KEY is empty but required with %s commit signing", commitSigning)
+		}
+		return commitSigning, commitSigningKey, nil
+	case CommitSigningAPI:
+		// only github creates commits through its api
+		for _, r := range repos {
+			if r.Provider != provider.GitHub {
+				return "", "", fmt.Errorf("%s commit signing is only supported on github repositories: %s", commitSigning, r)
+			}
+		}
+		return commitSigning, "", nil
+	default:
+		return "", "", fmt.Errorf("invalid COMMIT_SIGNING: %s", commitSigning)
+	}
+}
+
 func getPRTitle() (string, error) {
 	prTitle := os.Getenv("PR_TITLE")
 	if prTitle == "" {
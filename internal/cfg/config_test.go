@@ -0,0 +1,52 @@
+package cfg
+
+import "testing"
+
+func TestGetGithubAPIURLs(t *testing.T) {
+	tests := []struct {
+		name          string
+		githubURL     string
+		apiURL        string
+		uploadURL     string
+		wantAPIURL    string
+		wantUploadURL string
+	}{
+		{name: "github.com", githubURL: "github.com"},
+		{name: "github.com on a runner", githubURL: "github.com", apiURL: "https://api.github.com"},
+		{name: "github.com on a runner with trailing slash", githubURL: "github.com", apiURL: "https://api.github.com/"},
+		{
+			name:          "enterprise server derived",
+			githubURL:     "ghes.example.com",
+			wantAPIURL:    "https://ghes.example.com/api/v3/",
+			wantUploadURL: "https://ghes.example.com/api/uploads/",
+		},
+		{
+			name:          "enterprise server on a runner",
+			githubURL:     "ghes.example.com",
+			apiURL:        "https://ghes.example.com/api/v3",
+			wantAPIURL:    "https://ghes.example.com/api/v3",
+			wantUploadURL: "https://ghes.example.com/api/uploads/",
+		},
+		{
+			name:          "explicit urls",
+			githubURL:     "ghes.example.com",
+			apiURL:        "https://api.example.com/",
+			uploadURL:     "https://uploads.example.com/",
+			wantAPIURL:    "https://api.example.com/",
+			wantUploadURL: "https://uploads.example.com/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_API_URL", tt.apiURL)
+			t.Setenv("GITHUB_UPLOAD_URL", tt.uploadURL)
+			apiURL, uploadURL, err := getGithubAPIURLs(tt.githubURL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if apiURL != tt.wantAPIURL || uploadURL != tt.wantUploadURL {
+				t.Errorf("got %q, %q, want %q, %q", apiURL, uploadURL, tt.wantAPIURL, tt.wantUploadURL)
+			}
+		})
+	}
+}
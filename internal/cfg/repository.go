@@ -0,0 +1,142 @@
+package cfg
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gha-file-sync/internal/provider"
+)
+
+// Repository to synchronize.
+type Repository struct {
+	Provider provider.Kind
+	Owner    string // can contain slashes for gitlab subgroups
+	Name     string
+}
+
+// FullName of the repository: {OWNER}/{NAME}.
+func (r Repository) FullName() string {
+	return fmt.Sprintf("%s/%s", r.Owner, r.Name)
+}
+
+func (r Repository) String() string {
+	return fmt.Sprintf("%s:%s", r.Provider, r.FullName())
+}
+
+// ParseRepository from a repository entry: [{PROVIDER}:]{OWNER}/{NAME} or {PROVIDER}://{OWNER}/{NAME}.
+// The provider is github by default.
+func ParseRepository(entry string) (Repository, error) {
+	entry = strings.TrimSpace(entry)
+	r := Repository{Provider: provider.GitHub}
+
+	// extract the provider if any
+	if kindStr, fullName, found := strings.Cut(entry, ":"); found {
+		kind, err := provider.ParseKind(kindStr)
+		if err != nil {
+			return r, fmt.Errorf("invalid repo %s: %v", entry, err)
+		}
+		r.Provider = kind
+		// the provider can be written as a URL scheme
+		entry = strings.TrimPrefix(fullName, "//")
+	}
+
+	// gitlab accepts subgroups: only the last element is the name
+	split := strings.Split(entry, "/")
+	if len(split) < 2 || (r.Provider == provider.GitHub && len(split) != 2) { //nolint:gomnd
+		return r, fmt.Errorf("invalid repo name: %s {OWNER}/{NAME} expected", entry)
+	}
+	r.Owner = strings.Join(split[:len(split)-1], "/")
+	r.Name = split[len(split)-1]
+	if r.Owner == "" || r.Name == "" {
+		return r, fmt.Errorf("invalid repo name: %s {OWNER}/{NAME} expected", entry)
+	}
+	return r, nil
+}
+
+// RepositorySelector of github repositories of an owner, discovered through the api.
+// Disabled repositories are never selected.
+type RepositorySelector struct {
+	Owner           string         // organization or user
+	Topic           string         // optional
+	NamePattern     *regexp.Regexp // optional
+	Language        string         // optional, case insensitive
+	IncludeArchived bool
+	IncludeForks    bool
+}
+
+func (s RepositorySelector) String() string {
+	str := s.Owner
+	if s.Topic != "" {
+		str = fmt.Sprintf("%s;topic=%s", str, s.Topic)
+	}
+	if s.NamePattern != nil {
+		str = fmt.Sprintf("%s;name=%s", str, s.NamePattern)
+	}
+	if s.Language != "" {
+		str = fmt.Sprintf("%s;language=%s", str, s.Language)
+	}
+	if s.IncludeArchived {
+		str += ";archived=true"
+	}
+	if s.IncludeForks {
+		str += ";forks=true"
+	}
+	return str
+}
+
+// ParseRepositorySelector from a selector entry: {OWNER}[;{OPTION}={VALUE}...].
+// Available options: topic, name (regexp), language, archived=true|false, forks=true|false.
+func ParseRepositorySelector(entry string) (RepositorySelector, error) {
+	owner, optionsStr, _ := strings.Cut(strings.TrimSpace(entry), ";")
+	s := RepositorySelector{Owner: owner}
+	if s.Owner == "" || strings.Contains(s.Owner, "/") {
+		return s, fmt.Errorf("invalid repository selector %s: {OWNER} expected", entry)
+	}
+	if optionsStr == "" {
+		return s, nil
+	}
+
+	var err error
+	for _, option := range strings.Split(optionsStr, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		switch key {
+		case "topic":
+			s.Topic = value
+		case "name":
+			if s.NamePattern, err = regexp.Compile(value); err != nil {
+				return s, fmt.Errorf("invalid name in repository selector %s: %v", entry, err)
+			}
+		case "language":
+			s.Language = value
+		case "archived":
+			if s.IncludeArchived, err = strconv.ParseBool(value); err != nil {
+				return s, fmt.Errorf("invalid archived in repository selector %s: %v", entry, err)
+			}
+		case "forks":
+			if s.IncludeForks, err = strconv.ParseBool(value); err != nil {
+				return s, fmt.Errorf("invalid forks in repository selector %s: %v", entry, err)
+			}
+		default:
+			return s, fmt.Errorf("unknown option in repository selector %s: %s", entry, key)
+		}
+	}
+	return s, nil
+}
+
+// Matches returns true if the repository is selected.
+func (s RepositorySelector) Matches(r provider.RepositoryInfo) bool {
+	switch {
+	case r.Disabled,
+		r.Archived && !s.IncludeArchived,
+		r.Fork && !s.IncludeForks,
+		s.Topic != "" && !slices.Contains(r.Topics, s.Topic),
+		s.NamePattern != nil && !s.NamePattern.MatchString(r.Name),
+		s.Language != "" && !strings.EqualFold(s.Language, r.Language):
+		return false
+	default:
+		return true
+	}
+}
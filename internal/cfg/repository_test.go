@@ -0,0 +1,102 @@
+package cfg
+
+import (
+	"testing"
+
+	"gha-file-sync/internal/provider"
+)
+
+func TestParseRepository(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    Repository
+		wantErr bool
+	}{
+		{entry: "owner/name", want: Repository{Provider: provider.GitHub, Owner: "owner", Name: "name"}},
+		{entry: " owner/name ", want: Repository{Provider: provider.GitHub, Owner: "owner", Name: "name"}},
+		{entry: "github:owner/name", want: Repository{Provider: provider.GitHub, Owner: "owner", Name: "name"}},
+		{entry: "gitlab:group/sub/project", want: Repository{Provider: provider.GitLab, Owner: "group/sub", Name: "project"}},
+		{entry: "azure://project/repo", want: Repository{Provider: provider.Azure, Owner: "project", Name: "repo"}},
+		{entry: "github:group/sub/repo", wantErr: true},
+		{entry: "unknown:owner/name", wantErr: true},
+		{entry: "name", wantErr: true},
+		{entry: "owner/", wantErr: true},
+		{entry: "/name", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := ParseRepository(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRepositorySelector(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    string // canonical form
+		wantErr bool
+	}{
+		{entry: "org", want: "org"},
+		{entry: " org ", want: "org"},
+		{entry: "org;topic=go;name=^svc-;language=Go", want: "org;topic=go;name=^svc-;language=Go"},
+		{entry: "org; archived=true ;forks=1", want: "org;archived=true;forks=true"},
+		{entry: "org;archived=false", want: "org"},
+		{entry: "", wantErr: true},
+		{entry: "org/repo", wantErr: true},
+		{entry: ";topic=go", wantErr: true},
+		{entry: "org;name=(", wantErr: true},
+		{entry: "org;archived=maybe", wantErr: true},
+		{entry: "org;forks=", wantErr: true},
+		{entry: "org;private=true", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := ParseRepositorySelector(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositorySelectorMatches(t *testing.T) {
+	repo := provider.RepositoryInfo{Owner: "org", Name: "svc-api", Topics: []string{"go", "service"}, Language: "Go"}
+	archived, fork, disabled := repo, repo, repo
+	archived.Archived, fork.Fork, disabled.Disabled = true, true, true
+	tests := []struct {
+		selector string
+		info     provider.RepositoryInfo
+		want     bool
+	}{
+		{selector: "org", info: repo, want: true},
+		{selector: "org;topic=service;name=^svc-;language=go", info: repo, want: true},
+		{selector: "org;topic=web", info: repo},
+		{selector: "org;name=^lib-", info: repo},
+		{selector: "org;language=rust", info: repo},
+		{selector: "org", info: archived},
+		{selector: "org;archived=true", info: archived, want: true},
+		{selector: "org", info: fork},
+		{selector: "org;forks=true", info: fork, want: true},
+		{selector: "org;archived=true;forks=true", info: disabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			s, err := ParseRepositorySelector(tt.selector)
+			if err != nil {
+				t.Fatalf("parsing %s: %v", tt.selector, err)
+			}
+			if got := s.Matches(tt.info); got != tt.want {
+				t.Errorf("Matches(%+v) = %v, want %v", tt.info, got, tt.want)
+			}
+		})
+	}
+}
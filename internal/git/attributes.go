@@ -0,0 +1,216 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"gha-file-sync/internal/log"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+const (
+	// AttributesFileName of the files setting git attributes.
+	AttributesFileName = ".gitattributes"
+
+	// EOLLF line endings.
+	EOLLF = "lf"
+	// EOLCRLF line endings.
+	EOLCRLF = "crlf"
+
+	// binaryMacro is built in git.
+	binaryMacro = "[attr]binary -diff -merge -text"
+	// binarySniffLen is the length git looks for a NUL byte to detect binary contents.
+	binarySniffLen = 8000
+)
+
+// Attributes of the files of a repository, set by its .gitattributes files.
+type Attributes struct {
+	patterns []gitattributes.MatchAttribute // by increasing priority
+	macros   map[string]gitattributes.MatchAttribute
+}
+
+// ReadAttributes from the content of the .gitattributes files of a repository, by path.
+func ReadAttributes(files map[string][]byte) (Attributes, error) {
+	builtin, err := gitattributes.ParseAttributesLine(binaryMacro, nil, true)
+	if err != nil {
+		return Attributes{}, err
+	}
+	a := Attributes{macros: map[string]gitattributes.MatchAttribute{builtin.Name: builtin}}
+
+	// the deeper the file, the higher its priority
+	filePaths := make([]string, 0, len(files))
+	for filePath := range files {
+		filePaths = append(filePaths, filePath)
+	}
+	sort.Slice(filePaths, func(i, j int) bool {
+		iDepth, jDepth := strings.Count(filePaths[i], "/"), strings.Count(filePaths[j], "/")
+		if iDepth != jDepth {
+			return iDepth < jDepth
+		}
+		return filePaths[i] < filePaths[j]
+	})
+	for _, filePath := range filePaths {
+		var domain []string
+		if dir := path.Dir(filePath); dir != "." {
+			domain = strings.Split(dir, "/")
+		}
+		content := files[filePath]
+		if domain != nil {
+			content = withoutMacros(filePath, content)
+		}
+		patterns, err := gitattributes.ReadAttributes(bytes.NewReader(content), domain, domain == nil)
+		if err != nil {
+			return a, fmt.Errorf("reading %s: %v", filePath, err)
+		}
+		for _, p := range patterns {
+			if p.Pattern == nil {
+				a.macros[p.Name] = p
+				continue
+			}
+			a.patterns = append(a.patterns, p)
+		}
+	}
+	return a, nil
+}
+
+// withoutMacros definitions of a .gitattributes file out of the root: git ignores them with a warning.
+func withoutMacros(filePath string, content []byte) []byte {
+	lines := bytes.Split(content, []byte("\n"))
+	kept := lines[:0]
+	for _, line := range lines {
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("[attr]")) {
+			log.Warnf("%s: %s ignored, macros can only be defined at the root", filePath, bytes.TrimSpace(line))
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return bytes.Join(kept, []byte("\n"))
+}
+
+// GetAttributes of the sync branch head, read from its tree: the work tree may be sparse.
+// Only the blobs of the .gitattributes files are read.
+func (r *Repository) GetAttributes() (Attributes, error) {
+	tree, err := r.headTree()
+	if err != nil {
+		return Attributes{}, err
+	}
+	files := map[string][]byte{}
+	err = walkFiles(tree, func(filePath string, entry object.TreeEntry) error {
+		if path.Base(filePath) != AttributesFileName {
+			return nil
+		}
+		blob, err := r.repo.BlobObject(entry.Hash)
+		if err != nil {
+			return err
+		}
+		reader, err := blob.Reader()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		if files[filePath], err = io.ReadAll(reader); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return Attributes{}, fmt.Errorf("reading %s files: %v", AttributesFileName, err)
+	}
+	return ReadAttributes(files)
+}
+
+// match the attributes of the file, by name: the last matching pattern prevails.
+func (a Attributes) match(filePath string) map[string]gitattributes.Attribute {
+	pathParts := strings.Split(filePath, "/")
+	attrs := map[string]gitattributes.Attribute{}
+	for _, p := range a.patterns {
+		if !p.Pattern.Match(pathParts) {
+			continue
+		}
+		for _, attr := range p.Attributes {
+			if macro, ok := a.macros[attr.Name()]; ok && attr.IsSet() {
+				for _, macroAttr := range macro.Attributes {
+					attrs[macroAttr.Name()] = macroAttr
+				}
+			}
+			attrs[attr.Name()] = attr
+		}
+	}
+	return attrs
+}
+
+// Normalize the content of the file as git stores it, for an unchanged file not to be seen as changed:
+// - binary files are kept as is.
+// - files with a working-tree-encoding are converted to UTF-8.
+// - text files get LF line endings, whatever their eol attribute which only applies to the checkout.
+// - other files get the given line endings, if any: lf, crlf.
+func (a Attributes) Normalize(filePath string, content []byte, eol string) ([]byte, error) {
+	attrs := a.match(filePath)
+	text := attrs["text"]
+	if text != nil && text.IsUnset() {
+		return content, nil
+	}
+
+	isText := false
+	if encoding := attrs["working-tree-encoding"]; encoding != nil && encoding.IsValueSet() {
+		var err error
+		if content, err = toUTF8(content, encoding.Value()); err != nil {
+			return nil, fmt.Errorf("converting %s: %v", filePath, err)
+		}
+		isText = true
+	}
+	switch {
+	case text != nil && text.IsSet():
+		isText = true
+	case text != nil && text.IsValueSet() && text.Value() == "auto":
+		isText = !isBinary(content)
+	case attrs["eol"] != nil && attrs["eol"].IsValueSet():
+		isText = true
+	}
+
+	if isText {
+		return toLF(content), nil
+	}
+	if eol == "" || isBinary(content) {
+		return content, nil
+	}
+	content = toLF(content)
+	if eol == EOLCRLF {
+		content = bytes.ReplaceAll(content, []byte("\n"), []byte("\r\n"))
+	}
+	return content, nil
+}
+
+// isBinary content if it has a NUL byte in its beginning, as git guesses.
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) >= 0
+}
+
+// toLF line endings.
+func toLF(content []byte) []byte {
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+}
+
+// toUTF8 content from the given encoding, named as in a working-tree-encoding attribute.
+func toUTF8(content []byte, encodingName string) ([]byte, error) {
+	// git accepts a BOM suffix to write a byte order mark on checkout: it is never stored
+	encoding, err := ianaindex.IANA.Encoding(strings.TrimSuffix(strings.ToUpper(encodingName), "-BOM"))
+	if err != nil {
+		return nil, err
+	}
+	if encoding == nil {
+		return nil, fmt.Errorf("unsupported encoding %s", encodingName)
+	}
+	utf8Content, err := encoding.NewDecoder().Bytes(content)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(utf8Content, []byte("\xef\xbb\xbf")), nil
+}
@@ -0,0 +1,99 @@
+package git
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	rootAttrs := []byte("* text=auto\n" +
+		"*.sh text eol=lf\n" +
+		"*.bat eol=crlf\n" +
+		"*.png binary\n" +
+		"*.dat -text\n" +
+		"*.txt working-tree-encoding=UTF-16LE-BOM\n" +
+		"[attr]generated -text linguist-generated\n" +
+		"*.gen generated\n")
+	files := map[string][]byte{
+		AttributesFileName: rootAttrs,
+		// macros out of the root are ignored, the other lines apply
+		"sub/" + AttributesFileName: []byte("[attr]ignored -text\n*.md -text\n"),
+	}
+	attrs, err := ReadAttributes(files)
+	if err != nil {
+		t.Fatalf("ReadAttributes() error = %v", err)
+	}
+	noAttrs, err := ReadAttributes(nil)
+	if err != nil {
+		t.Fatalf("ReadAttributes() error = %v", err)
+	}
+
+	utf16 := []byte{0xff, 0xfe, 'a', 0, '\r', 0, '\n', 0}
+	tests := []struct {
+		name     string
+		attrs    Attributes
+		filePath string
+		content  string
+		eol      string
+		want     string
+	}{
+		{name: "auto text", attrs: attrs, filePath: "a.go", content: "a\r\nb\r\n", want: "a\nb\n"},
+		{name: "auto binary", attrs: attrs, filePath: "a.bin", content: "a\x00\r\n", want: "a\x00\r\n"},
+		{name: "text with eol", attrs: attrs, filePath: "run.sh", content: "a\r\n", want: "a\n"},
+		{name: "eol sets text", attrs: attrs, filePath: "run.bat", content: "a\r\n", want: "a\n"},
+		{name: "binary macro", attrs: attrs, filePath: "a.png", content: "a\r\n", eol: EOLCRLF, want: "a\r\n"},
+		{name: "unset text", attrs: attrs, filePath: "a.dat", content: "a\r\n", want: "a\r\n"},
+		{name: "root macro", attrs: attrs, filePath: "a.gen", content: "a\r\n", want: "a\r\n"},
+		{name: "nested file", attrs: attrs, filePath: "sub/a.md", content: "a\r\n", want: "a\r\n"},
+		{name: "nested file out of its directory", attrs: attrs, filePath: "a.md", content: "a\r\n", want: "a\n"},
+		{name: "working tree encoding", attrs: attrs, filePath: "a.txt", content: string(utf16), want: "a\n"},
+		{name: "no attributes", attrs: noAttrs, filePath: "a.go", content: "a\r\n", want: "a\r\n"},
+		{name: "no attributes with lf", attrs: noAttrs, filePath: "a.go", content: "a\r\nb\n", eol: EOLLF, want: "a\nb\n"},
+		{name: "no attributes with crlf", attrs: noAttrs, filePath: "a.go", content: "a\r\nb\n", eol: EOLCRLF, want: "a\r\nb\r\n"},
+		{name: "no attributes binary", attrs: noAttrs, filePath: "a.go", content: "a\x00\n", eol: EOLCRLF, want: "a\x00\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.attrs.Normalize(tt.filePath, []byte(tt.content), tt.eol)
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Normalize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAttributes(t *testing.T) {
+	repo, _ := initRepo(t)
+	commitFiles(t, repo, map[string][]byte{
+		AttributesFileName:          []byte("*.dat -text\n"),
+		"sub/" + AttributesFileName: []byte("[attr]nested -text\n*.txt nested\n*.md -text\n"),
+		"sub/a.md":                  []byte("a"),
+		"b.go":                      []byte("b"),
+	})
+	r := &Repository{repo: repo}
+
+	attrs, err := r.GetAttributes()
+	if err != nil {
+		t.Fatalf("GetAttributes() error = %v", err)
+	}
+	tests := []struct {
+		filePath string
+		want     string
+	}{
+		{filePath: "a.dat", want: "a\r\n"},
+		{filePath: "sub/a.md", want: "a\r\n"},
+		{filePath: "sub/a.txt", want: "a\n"}, // the nested macro is ignored
+		{filePath: "a.md", want: "a\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filePath, func(t *testing.T) {
+			got, err := attrs.Normalize(tt.filePath, []byte("a\r\n"), EOLLF)
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Normalize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
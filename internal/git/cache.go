@@ -0,0 +1,233 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gha-file-sync/internal/log"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// lockFileExt of the lock file next to each cached clone: its modification time is the last use of the clone.
+const lockFileExt = ".lock"
+
+// reuse the clone cached at the local path if any: it is fetched and hard reset on the base branch.
+// It returns false if there is no clone to reuse.
+func (r *Repository) reuse(ctx context.Context) (bool, error) {
+	repo, err := git.PlainOpen(r.localPath)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("opening cached clone: %v", err)
+	}
+	r.repo = repo
+
+	// the url or the transport may have changed since the clone
+	c, err := repo.Config()
+	if err != nil {
+		return false, fmt.Errorf("getting config: %v", err)
+	}
+	origin, ok := c.Remotes["origin"]
+	if !ok {
+		return false, fmt.Errorf("no origin remote in cached clone")
+	}
+	origin.URLs = []string{r.repoURL}
+
+	// forget the local branches of previous syncs: the default branch may have changed since the clone
+	if r.baseBranchName, err = remoteDefaultBranch(ctx, r.repoURL, r.auth); err != nil {
+		return false, err
+	}
+	baseBranchName := r.baseBranchName
+	for name := range c.Branches {
+		if name != baseBranchName {
+			delete(c.Branches, name)
+		}
+	}
+	if err := repo.SetConfig(c); err != nil {
+		return false, fmt.Errorf("setting config: %v", err)
+	}
+	branches, err := repo.Branches()
+	if err != nil {
+		return false, fmt.Errorf("listing branches: %v", err)
+	}
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name().Short() == baseBranchName {
+			return nil
+		}
+		return repo.Storer.RemoveReference(ref.Name())
+	})
+	if err != nil {
+		return false, fmt.Errorf("removing branches: %v", err)
+	}
+
+	// hard reset the base branch on its remote state
+	if err := r.fetchBranch(ctx, baseBranchName); err != nil {
+		return false, err
+	}
+	remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", baseBranchName), true)
+	if err != nil {
+		return false, fmt.Errorf("getting remote base branch: %v", err)
+	}
+	baseRefName := plumbing.NewBranchReferenceName(baseBranchName)
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(baseRefName, remoteRef.Hash())); err != nil {
+		return false, fmt.Errorf("resetting base branch: %v", err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, baseRefName)); err != nil {
+		return false, fmt.Errorf("setting head: %v", err)
+	}
+
+	// empty the work tree and the index, as a fresh clone: the sparse paths may differ from the previous sync
+	entries, err := os.ReadDir(r.localPath)
+	if err != nil {
+		return false, fmt.Errorf("reading worktree: %v", err)
+	}
+	for _, e := range entries {
+		if e.Name() == ".git" {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(r.localPath, e.Name())); err != nil {
+			return false, fmt.Errorf("cleaning worktree: %v", err)
+		}
+	}
+	if err := os.Remove(filepath.Join(r.localPath, ".git", "index")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("removing index: %v", err)
+	}
+	// sparse checkouts are done by the sync branch setup only, as after a clone
+	if len(r.sparsePaths) > 0 {
+		return true, nil
+	}
+	workTree, err := repo.Worktree()
+	if err != nil {
+		return false, fmt.Errorf("getting worktree: %v", err)
+	}
+	if err := workTree.Checkout(&git.CheckoutOptions{Branch: baseRefName, Force: true}); err != nil {
+		return false, fmt.Errorf("checkout %s: %v", baseRefName, err)
+	}
+	return true, nil
+}
+
+// lock the cached clone at the local path, waiting for any other job using it.
+func (r *Repository) lock() error {
+	lockPath := r.localPath + lockFileExt
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0o755); err != nil { //nolint:gomnd
+		return fmt.Errorf("creating cache directory: %v", err)
+	}
+	unlock, locked, err := lockFile(lockPath, false)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		log.Infof("waiting for another job using the cached clone %s...", r.localPath)
+		if unlock, _, err = lockFile(lockPath, true); err != nil {
+			return err
+		}
+	}
+	// mark the clone as used now, for the eviction
+	now := time.Now()
+	if err := os.Chtimes(lockPath, now, now); err != nil {
+		_ = unlock()
+		return fmt.Errorf("touching lock file: %v", err)
+	}
+	r.unlock = unlock
+	return nil
+}
+
+// EvictCache removes the least recently used clones of the cache directory until its size is under maxSize bytes.
+// Clones in use are kept.
+func EvictCache(cacheDir string, maxSize int64) error {
+	type cachedClone struct {
+		path     string
+		size     int64
+		lastUsed time.Time
+	}
+
+	// find clones by their lock file
+	clones := []cachedClone{}
+	err := filepath.WalkDir(cacheDir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// do not look for lock files inside clones
+			if _, statErr := os.Stat(filepath.Join(filePath, ".git")); statErr == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(filePath, lockFileExt) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		clonePath := strings.TrimSuffix(filePath, lockFileExt)
+		size, err := dirSize(clonePath)
+		if err != nil {
+			return err
+		}
+		clones = append(clones, cachedClone{path: clonePath, size: size, lastUsed: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("listing cached clones: %v", err)
+	}
+
+	// keep the most recently used clones within the max size
+	sort.Slice(clones, func(i, j int) bool { return clones[i].lastUsed.After(clones[j].lastUsed) })
+	var totalSize int64
+	for _, c := range clones {
+		totalSize += c.size
+		if totalSize <= maxSize || c.size == 0 {
+			continue
+		}
+		unlock, locked, err := lockFile(c.path+lockFileExt, false)
+		if err != nil {
+			return err
+		}
+		if !locked {
+			log.Warnf("cached clone %s is in use, not evicted", c.path)
+			continue
+		}
+		log.Infof("evicting cached clone %s (%d bytes)", c.path, c.size)
+		err = os.RemoveAll(c.path)
+		_ = unlock()
+		if err != nil {
+			return fmt.Errorf("removing %s: %v", c.path, err)
+		}
+		totalSize -= c.size
+	}
+	return nil
+}
+
+// dirSize in bytes, 0 if it doesn't exist.
+func dirSize(dirPath string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dirPath, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	return size, err
+}
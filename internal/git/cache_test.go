@@ -0,0 +1,79 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestEvictCache(t *testing.T) {
+	// clones of 100 bytes, by path, used from the oldest to the most recent
+	clonePaths := []string{"github/o/oldest", "github/o/old", "gitlab/g/recent", "github/o/newest"}
+	tests := []struct {
+		name    string
+		maxSize int64
+		inUse   string
+		want    []string
+	}{
+		{name: "under max size", maxSize: 400, want: clonePaths},
+		{name: "least recently used evicted", maxSize: 250, want: []string{"gitlab/g/recent", "github/o/newest"}},
+		{name: "all evicted", maxSize: 50, want: []string{}},
+		{
+			name: "clone in use kept", maxSize: 250, inUse: "github/o/oldest",
+			want: []string{"github/o/oldest", "gitlab/g/recent", "github/o/newest"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			lastUsed := time.Now().Add(-time.Hour)
+			for _, clonePath := range clonePaths {
+				absPath := filepath.Join(cacheDir, clonePath)
+				if err := os.MkdirAll(filepath.Join(absPath, ".git"), 0o755); err != nil {
+					t.Fatalf("creating %s: %v", clonePath, err)
+				}
+				if err := os.WriteFile(filepath.Join(absPath, ".git", "pack"), make([]byte, 100), 0o644); err != nil {
+					t.Fatalf("writing %s: %v", clonePath, err)
+				}
+				// a lock file inside a clone is not another clone
+				if err := os.WriteFile(filepath.Join(absPath, "file"+lockFileExt), nil, 0o644); err != nil {
+					t.Fatalf("writing %s: %v", clonePath, err)
+				}
+				if err := os.WriteFile(absPath+lockFileExt, nil, 0o644); err != nil {
+					t.Fatalf("writing lock of %s: %v", clonePath, err)
+				}
+				lastUsed = lastUsed.Add(time.Minute)
+				if err := os.Chtimes(absPath+lockFileExt, lastUsed, lastUsed); err != nil {
+					t.Fatalf("touching lock of %s: %v", clonePath, err)
+				}
+			}
+			if tt.inUse != "" {
+				unlock, locked, err := lockFile(filepath.Join(cacheDir, tt.inUse)+lockFileExt, false)
+				if err != nil || !locked {
+					t.Fatalf("locking %s: %v", tt.inUse, err)
+				}
+				defer unlock() //nolint:errcheck
+			}
+
+			if err := EvictCache(cacheDir, tt.maxSize); err != nil {
+				t.Fatalf("EvictCache() error = %v", err)
+			}
+
+			got := []string{}
+			for _, clonePath := range clonePaths {
+				if _, err := os.Stat(filepath.Join(cacheDir, clonePath)); err == nil {
+					got = append(got, clonePath)
+				}
+			}
+			want := append([]string{}, tt.want...)
+			sort.Strings(got)
+			sort.Strings(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("kept clones = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"os"
+	"strings"
+
+	"gha-file-sync/internal/log"
+
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// LFSConfigPath of the file setting the LFS configuration of a repository.
+const LFSConfigPath = ".lfsconfig"
+
+const (
+	lfsMediaType      = "application/vnd.git-lfs+json"
+	lfsPointerVersion = "https://git-lfs.github.com/spec/v1"
+)
+
+// LFSObject referenced by a pointer file, to upload to the LFS server.
+type LFSObject struct {
+	OID  string `json:"oid"` // sha256 of the content
+	Size int64  `json:"size"`
+	Path string `json:"-"` // local file holding the content
+}
+
+// IsLFS returns true if the file is tracked by git LFS: it is stored as a pointer.
+func (a Attributes) IsLFS(filePath string) bool {
+	filter := a.match(filePath)["filter"]
+	return filter != nil && filter.IsValueSet() && filter.Value() == "lfs"
+}
+
+// NewLFSPointer to the content of the local file at localPath, with the object to upload.
+func NewLFSPointer(content []byte, localPath string) ([]byte, LFSObject) {
+	hash := sha256.Sum256(content)
+	obj := LFSObject{OID: hex.EncodeToString(hash[:]), Size: int64(len(content)), Path: localPath}
+	pointer := fmt.Sprintf("version %s\noid sha256:%s\nsize %d\n", lfsPointerVersion, obj.OID, obj.Size)
+	return []byte(pointer), obj
+}
+
+// lfsBatchObject of a batch response, with the actions to perform.
+type lfsBatchObject struct {
+	LFSObject
+	Actions map[string]struct {
+		Href   string            `json:"href"`
+		Header map[string]string `json:"header"`
+	} `json:"actions"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// LFSEndpoint of the LFS server of the repository: the lfs.url of its .lfsconfig file if set,
+// otherwise derived from its https url as git-lfs does.
+func LFSEndpoint(repoURL string, lfsConfig []byte) (string, error) {
+	if len(lfsConfig) > 0 {
+		c := format.New()
+		if err := format.NewDecoder(bytes.NewReader(lfsConfig)).Decode(c); err != nil {
+			return "", fmt.Errorf("reading %s: %v", LFSConfigPath, err)
+		}
+		if endpoint := c.Section("lfs").Option("url"); endpoint != "" {
+			return strings.TrimSuffix(endpoint, "/"), nil
+		}
+	}
+	endpoint := strings.TrimSuffix(repoURL, "/")
+	// azure devops repository urls have no .git suffix
+	if !strings.HasSuffix(endpoint, ".git") && !strings.Contains(endpoint, "/_git/") {
+		endpoint += ".git"
+	}
+	return endpoint + "/info/lfs", nil
+}
+
+// UploadLFSObjects with the batch API of the LFS server at the endpoint, see LFSEndpoint.
+// Objects the server already has are skipped.
+func UploadLFSObjects(
+	ctx context.Context,
+	client *nethttp.Client, endpoint string, auth http.AuthMethod,
+	objects []LFSObject,
+) error {
+	if len(objects) == 0 {
+		return nil
+	}
+	batchURL := endpoint + "/objects/batch"
+
+	batchReq := map[string]any{"operation": "upload", "transfers": []string{"basic"}, "objects": objects}
+	var batchResp struct {
+		Objects []lfsBatchObject `json:"objects"`
+	}
+	if err := lfsDo(ctx, client, nethttp.MethodPost, batchURL, auth, nil, batchReq, &batchResp); err != nil {
+		return fmt.Errorf("requesting lfs upload: %v", err)
+	}
+
+	paths := make(map[string]string, len(objects))
+	for _, obj := range objects {
+		paths[obj.OID] = obj.Path
+	}
+	for _, obj := range batchResp.Objects {
+		if obj.Error != nil {
+			return fmt.Errorf("lfs object %s: %d %s", obj.OID, obj.Error.Code, obj.Error.Message)
+		}
+		upload, ok := obj.Actions["upload"]
+		if !ok {
+			continue // already uploaded
+		}
+		log.Infof("uploading lfs object %s (%d bytes)", obj.OID, obj.Size)
+		if err := lfsUpload(ctx, client, upload.Href, upload.Header, paths[obj.OID], obj.Size); err != nil {
+			return fmt.Errorf("uploading lfs object %s: %v", obj.OID, err)
+		}
+		if verify, ok := obj.Actions["verify"]; ok {
+			if err := lfsDo(ctx, client, nethttp.MethodPost, verify.Href, nil, verify.Header, obj.LFSObject, nil); err != nil {
+				return fmt.Errorf("verifying lfs object %s: %v", obj.OID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// lfsUpload the content of the local file as told by the upload action.
+func lfsUpload(ctx context.Context, client *nethttp.Client, href string, header map[string]string, localPath string, size int64) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodPut, href, f)
+	if err != nil {
+		return fmt.Errorf("building request: %v", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= nethttp.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024)) //nolint:gomnd
+		return fmt.Errorf("PUT %s: %d %s", href, resp.StatusCode, msg)
+	}
+	return nil
+}
+
+// lfsDo a json request to the LFS server, authenticated with the given headers or the git authentication.
+func lfsDo(ctx context.Context, client *nethttp.Client, method, url string, auth http.AuthMethod, header map[string]string, body, out any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encoding body: %v", err)
+	}
+	req, err := nethttp.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("building request: %v", err)
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	if auth != nil {
+		auth.SetAuth(req)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= nethttp.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024)) //nolint:gomnd
+		return fmt.Errorf("%s %s: %d %s", method, url, resp.StatusCode, msg)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decoding response: %v", err)
+		}
+	}
+	return nil
+}
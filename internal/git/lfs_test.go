@@ -0,0 +1,134 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+func TestLFSEndpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		repoURL   string
+		lfsConfig string
+		want      string
+		wantErr   bool
+	}{
+		{name: "github", repoURL: "https://github.com/o/r.git", want: "https://github.com/o/r.git/info/lfs"},
+		{name: "without .git suffix", repoURL: "https://gitlab.com/g/p", want: "https://gitlab.com/g/p.git/info/lfs"},
+		{name: "trailing slash", repoURL: "https://gitlab.com/g/p/", want: "https://gitlab.com/g/p.git/info/lfs"},
+		{name: "azure devops", repoURL: "https://dev.azure.com/org/proj/_git/repo", want: "https://dev.azure.com/org/proj/_git/repo/info/lfs"},
+		{
+			name: "lfsconfig url", repoURL: "https://github.com/o/r.git",
+			lfsConfig: "[lfs]\n\turl = https://lfs.example.com/o/r/\n", want: "https://lfs.example.com/o/r",
+		},
+		{
+			name: "lfsconfig without url", repoURL: "https://github.com/o/r.git",
+			lfsConfig: "[lfs]\n\tlocksverify = false\n", want: "https://github.com/o/r.git/info/lfs",
+		},
+		{name: "invalid lfsconfig", repoURL: "https://github.com/o/r.git", lfsConfig: "[lfs\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LFSEndpoint(tt.repoURL, []byte(tt.lfsConfig))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LFSEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LFSEndpoint() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadLFSObjects(t *testing.T) {
+	tests := []struct {
+		name         string
+		present      bool // the server already has the object
+		objectError  bool
+		batchStatus  int
+		wantUploaded bool
+		wantVerified bool
+		wantErr      bool
+	}{
+		{name: "upload and verify", batchStatus: nethttp.StatusOK, wantUploaded: true, wantVerified: true},
+		{name: "already present", present: true, batchStatus: nethttp.StatusOK},
+		{name: "object error", objectError: true, batchStatus: nethttp.StatusOK, wantErr: true},
+		{name: "batch refused", batchStatus: nethttp.StatusForbidden, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := []byte("large content")
+			localPath := filepath.Join(t.TempDir(), "large.bin")
+			if err := os.WriteFile(localPath, content, 0o644); err != nil {
+				t.Fatalf("writing object: %v", err)
+			}
+			_, obj := NewLFSPointer(content, localPath)
+
+			var uploaded []byte
+			verified := false
+			mux := nethttp.NewServeMux()
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+			mux.HandleFunc("/o/r.git/info/lfs/objects/batch", func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				if user, _, _ := r.BasicAuth(); user != "token" {
+					t.Errorf("batch request without the git credentials")
+				}
+				var req struct {
+					Operation string      `json:"operation"`
+					Objects   []LFSObject `json:"objects"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Operation != "upload" || len(req.Objects) != 1 {
+					t.Errorf("unexpected batch request %+v: %v", req, err)
+				}
+				w.Header().Set("Content-Type", lfsMediaType)
+				w.WriteHeader(tt.batchStatus)
+				switch {
+				case tt.batchStatus != nethttp.StatusOK:
+					fmt.Fprint(w, `{"message":"forbidden"}`)
+				case tt.present:
+					fmt.Fprintf(w, `{"objects":[{"oid":%q,"size":%d}]}`, obj.OID, obj.Size)
+				case tt.objectError:
+					fmt.Fprintf(w, `{"objects":[{"oid":%q,"size":%d,"error":{"code":422,"message":"invalid"}}]}`, obj.OID, obj.Size)
+				default:
+					fmt.Fprintf(w, `{"objects":[{"oid":%q,"size":%d,"actions":{`+
+						`"upload":{"href":"%s/upload","header":{"Authorization":"Bearer upload"}},`+
+						`"verify":{"href":"%s/verify","header":{"Authorization":"Bearer verify"}}}}]}`,
+						obj.OID, obj.Size, srv.URL, srv.URL)
+				}
+			})
+			mux.HandleFunc("/upload", func(_ nethttp.ResponseWriter, r *nethttp.Request) {
+				if r.Method != nethttp.MethodPut || r.Header.Get("Authorization") != "Bearer upload" {
+					t.Errorf("unexpected upload request %s with %s", r.Method, r.Header.Get("Authorization"))
+				}
+				uploaded, _ = io.ReadAll(r.Body)
+			})
+			mux.HandleFunc("/verify", func(_ nethttp.ResponseWriter, r *nethttp.Request) {
+				if r.Header.Get("Authorization") != "Bearer verify" {
+					t.Errorf("unexpected verify request with %s", r.Header.Get("Authorization"))
+				}
+				verified = true
+			})
+
+			auth := &http.BasicAuth{Username: "token", Password: "x"}
+			err := UploadLFSObjects(context.Background(), srv.Client(), srv.URL+"/o/r.git/info/lfs", auth, []LFSObject{obj})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UploadLFSObjects() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantUploaded != (string(uploaded) == string(content)) {
+				t.Errorf("uploaded %q, want uploaded %v", uploaded, tt.wantUploaded)
+			}
+			if verified != tt.wantVerified {
+				t.Errorf("verified %v, want %v", verified, tt.wantVerified)
+			}
+		})
+	}
+}
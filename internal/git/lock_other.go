@@ -0,0 +1,10 @@
+//go:build !unix
+
+package git
+
+import "fmt"
+
+// lockFile is only supported on unix systems: the clone cache cannot be used elsewhere.
+func lockFile(lockPath string, wait bool) (unlock func() error, locked bool, err error) {
+	return nil, false, fmt.Errorf("locking %s: file locks are not supported on this system", lockPath)
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile with an exclusive advisory lock, released by the returned function or when the process exits.
+// Without wait, locked is false if the file is already locked.
+func lockFile(lockPath string, wait bool) (unlock func() error, locked bool, err error) {
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644) //nolint:gomnd
+	if err != nil {
+		return nil, false, fmt.Errorf("opening lock file: %v", err)
+	}
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("locking %s: %v", lockPath, err)
+	}
+	return f.Close, true, nil // closing the file releases the lock
+}
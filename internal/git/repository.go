@@ -2,71 +2,156 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"sort"
+	"strings"
 	"time"
 
+	"gha-file-sync/internal/log"
+
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
 )
 
+// Identity of a commit author or committer.
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// String in the format used by commit trailers: "Name <email>".
+func (i Identity) String() string {
+	return fmt.Sprintf("%s <%s>", i.Name, i.Email)
+}
+
+// Override the identity fields with the non-empty ones of the given identity.
+func (i Identity) Override(o Identity) Identity {
+	if o.Name != "" {
+		i.Name = o.Name
+	}
+	if o.Email != "" {
+		i.Email = o.Email
+	}
+	return i
+}
+
+// ErrRemoteMoved is returned when a push is rejected because the remote branch has new commits.
+var ErrRemoteMoved = errors.New("remote branch has moved")
+
+// CloneOptions to reduce what is cloned.
+type CloneOptions struct {
+	Depth       int      // number of commits to fetch per branch, full history if 0
+	SparsePaths []string // top-level directories to check out, ending with a slash, the whole tree if empty
+	Cached      bool     // keep the clone across runs: it is locked while used, then fetched and reset instead of cloned
+}
+
 type Repository struct {
 	// git config
 	syncBranchName string
 	repoURL        string
 	localPath      string
+	depth          int
+	sparsePaths    []string
+	cached         bool
 
 	// auth config
-	auth       *http.BasicAuth
-	authorName string
+	auth      transport.AuthMethod
+	author    Identity
+	committer Identity
+	signer    git.Signer // optional: commits are not signed if nil
 
 	// internal state
-	baseBranchName string // main or master
+	baseBranchName string // default branch of the remote
 	repo           *git.Repository
 	workTree       *git.Worktree
 	syncRef        *plumbing.Reference
+	unlock         func() error // releases the cached clone, nil if not cached
 }
 
 // NewRepository clones a repository locally based on given parameters and returns a reference to its object.
 func NewRepository(
 	ctx context.Context,
 	localPath, repoURL, syncBranchName string,
-	auth *http.BasicAuth, authorName string,
+	auth transport.AuthMethod, author, committer Identity,
+	cloneOpt CloneOptions,
 ) (*Repository, error) {
 	// init the repository
 	r := &Repository{
 		localPath:      localPath,
 		repoURL:        repoURL,
 		syncBranchName: syncBranchName,
+		depth:          cloneOpt.Depth,
+		sparsePaths:    cloneOpt.SparsePaths,
+		cached:         cloneOpt.Cached,
 
-		auth:       auth,
-		authorName: authorName,
+		auth:      auth,
+		author:    author,
+		committer: committer,
 	}
 
-	// first clean any remains for older sync that went wrong
-	// ignore errors
-	_ = r.Clean()
+	// cached clone: reuse it if possible
+	if r.cached {
+		if err := r.lock(); err != nil {
+			return nil, err
+		}
+		reused, err := r.reuse(ctx)
+		if err == nil && reused {
+			return r, nil
+		}
+		if err != nil {
+			log.Warnf("cached clone %s cannot be reused, cloning again: %v", localPath, err)
+		}
+		r.repo = nil
+		r.baseBranchName = ""
+		if err := os.RemoveAll(localPath); err != nil {
+			_ = r.Clean()
+			return nil, fmt.Errorf("removing cached clone: %v", err)
+		}
+	} else {
+		// first clean any remains for older sync that went wrong
+		// ignore errors
+		_ = r.Clean()
+	}
 
-	// try to clone to local path
+	// try to clone to local path: only the default branch, other branches are fetched on demand
+	// with sparse paths, the checkout is done once the sync branch is known
 	opt := &git.CloneOptions{
-		URL:  r.repoURL,
-		Auth: r.auth,
+		URL:          r.repoURL,
+		Auth:         r.auth,
+		Depth:        r.depth,
+		SingleBranch: true,
+		NoCheckout:   len(r.sparsePaths) > 0,
 	}
 	isBare := false
 	repo, err := git.PlainCloneContext(ctx, localPath, isBare, opt)
 	if err != nil {
+		_ = r.Clean()
 		return nil, fmt.Errorf("cloning: %v", err)
 	}
 	r.repo = repo
 
+	// the base branch is the default branch of the remote, the one cloned
+	head, err := repo.Head()
+	if err != nil {
+		_ = r.Clean()
+		return nil, fmt.Errorf("getting head: %v", err)
+	}
+	r.baseBranchName = head.Name().Short()
+
 	return r, nil
 }
 
-// GetBaseBranchName based on the repo.
-// First, it tries to get a "main" branch, then a "master" branch, then it fails.
+// GetBaseBranchName: the default branch of the remote.
+// If unknown, it tries to get a "main" branch, then a "master" branch, then it fails.
 func (r *Repository) GetBaseBranchName() (string, error) {
 	if r.baseBranchName == "" {
 		c, err := r.repo.Config()
@@ -95,6 +180,46 @@ func (r *Repository) SetSyncBranchName(name string) {
 	r.syncBranchName = name
 }
 
+// ListRemoteBranchNames of the origin remote, sorted by name.
+func (r *Repository) ListRemoteBranchNames(ctx context.Context) ([]string, error) {
+	remote, err := r.repo.Remote("origin")
+	if err != nil {
+		return nil, fmt.Errorf("getting origin remote: %v", err)
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: r.auth})
+	if err != nil {
+		return nil, fmt.Errorf("listing remote refs: %v", err)
+	}
+	branchNames := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		if ref.Name().IsBranch() {
+			branchNames = append(branchNames, ref.Name().Short())
+		}
+	}
+	sort.Strings(branchNames)
+	return branchNames, nil
+}
+
+// remoteDefaultBranch of the repository at the url: the branch its HEAD points to.
+func remoteDefaultBranch(ctx context.Context, repoURL string, auth transport.AuthMethod) (string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{repoURL}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("listing remote refs: %v", err)
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			return ref.Target().Short(), nil
+		}
+	}
+	return "", fmt.Errorf("no default branch advertised by the remote")
+}
+
+// SetSigner used to sign commits.
+func (r *Repository) SetSigner(signer git.Signer) {
+	r.signer = signer
+}
+
 // IsNotSetup returns true if any important internal state variable is not set.
 func (r *Repository) IsNotSetup() bool {
 	return (r.repo == nil ||
@@ -103,60 +228,390 @@ func (r *Repository) IsNotSetup() bool {
 }
 
 // Add, Commit, Push from the current local folder to remote.
+// Only the sync branch is pushed. Without force, ErrRemoteMoved is returned if the remote branch has new commits.
 func (r *Repository) AddCommitPush(
-	ctx context.Context, commitMsg string,
+	ctx context.Context, commitMsg string, force bool,
 ) error {
 	// add all files
-	opt := git.AddOptions{
-		All:  true,
-		Path: r.localPath,
-	}
-	if err := r.workTree.AddWithOptions(&opt); err != nil {
-		return fmt.Errorf("adding: %v", err)
+	if err := r.stage(); err != nil {
+		return err
 	}
 
 	// commit changes
+	// staging modified files again would also stage files outside of the sparse paths as deleted
+	now := time.Now()
 	commitOpt := &git.CommitOptions{
-		All: true,
+		All: len(r.sparsePaths) == 0,
 		Author: &object.Signature{
-			Name: r.authorName,
-			When: time.Now(),
+			Name:  r.author.Name,
+			Email: r.author.Email,
+			When:  now,
 		},
+		Committer: &object.Signature{
+			Name:  r.committer.Name,
+			Email: r.committer.Email,
+			When:  now,
+		},
+		Signer: r.signer,
 	}
 	if _, err := r.workTree.Commit(commitMsg, commitOpt); err != nil {
 		return fmt.Errorf("committing: %v", err)
 	}
 
 	// push to remote
+	syncRefName := plumbing.NewBranchReferenceName(r.syncBranchName)
 	pushOpt := &git.PushOptions{
 		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", syncRefName, syncRefName))},
 		Auth:       r.auth,
-		Force:      true,
+		Force:      force,
 		Atomic:     true,
 	}
 	if err := r.repo.PushContext(ctx, pushOpt); err != nil {
+		// go-git reports rejected updates with untyped errors: the remote branch head tells if it has moved.
+		// A forced push is not rejected for it.
+		if !force {
+			if moved, movedErr := r.remoteMoved(ctx, r.syncBranchName); movedErr == nil && moved {
+				return fmt.Errorf("pushing: %w", ErrRemoteMoved)
+			}
+		}
 		return fmt.Errorf("pushing: %v", err)
 	}
 	return nil
 }
 
+// Git file modes of a FileChange.
+var (
+	RegularMode    = fmt.Sprintf("%o", filemode.Regular)
+	ExecutableMode = fmt.Sprintf("%o", filemode.Executable)
+	SymlinkMode    = fmt.Sprintf("%o", filemode.Symlink)
+)
+
+// FileChange of the work tree, to commit without git: through a provider api for instance.
+type FileChange struct {
+	Path    string // relative to the repository root
+	Content []byte // link target for symbolic links
+	Mode    string // git file mode: 100644, 100755 or 120000
+	Deleted bool
+}
+
+// GetChanges of the work tree compared to the sync branch head, sorted by path, with the head commit hash.
+func (r *Repository) GetChanges() (headHash string, changes []FileChange, err error) {
+	// add all files to consider new files as well
+	if err := r.stage(); err != nil {
+		return "", nil, err
+	}
+	statuses, err := r.status()
+	if err != nil {
+		return "", nil, err
+	}
+	for filePath, status := range statuses {
+		switch status.Staging {
+		case git.Unmodified, git.Untracked:
+			continue
+		case git.Deleted:
+			changes = append(changes, FileChange{Path: filePath, Deleted: true})
+			continue
+		}
+		change, err := ReadFileChange(path.Join(r.localPath, filePath), filePath)
+		if err != nil {
+			return "", nil, err
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	head, err := r.repo.Head()
+	if err != nil {
+		return "", nil, fmt.Errorf("getting head: %v", err)
+	}
+	return head.Hash().String(), changes, nil
+}
+
+// ReadHeadFile content at filePath in the sync branch head, from its tree: the work tree may be sparse.
+// A symbolic link content is its target.
+func (r *Repository) ReadHeadFile(filePath string) (content []byte, exists bool, err error) {
+	tree, err := r.headTree()
+	if err != nil {
+		return nil, false, err
+	}
+	f, err := tree.File(filePath)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("getting %s: %v", filePath, err)
+	}
+	contentStr, err := f.Contents()
+	if err != nil {
+		return nil, false, fmt.Errorf("reading %s: %v", filePath, err)
+	}
+	return []byte(contentStr), true, nil
+}
+
+// ListBaseFiles paths in the base branch, from its tree: the work tree may be sparse.
+func (r *Repository) ListBaseFiles() ([]string, error) {
+	tree, err := r.baseTree()
+	if err != nil {
+		return nil, err
+	}
+	filePaths := []string{}
+	err = walkFiles(tree, func(filePath string, _ object.TreeEntry) error {
+		filePaths = append(filePaths, filePath)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing base files: %v", err)
+	}
+	return filePaths, nil
+}
+
+// walkFiles of the tree, recursively, without reading their blobs: submodules are skipped.
+func walkFiles(tree *object.Tree, fn func(filePath string, entry object.TreeEntry) error) error {
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		filePath, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.Mode.IsFile() {
+			continue
+		}
+		if err := fn(filePath, entry); err != nil {
+			return err
+		}
+	}
+}
+
+// headTree of the sync branch.
+func (r *Repository) headTree() (*object.Tree, error) {
+	head, err := r.repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("getting head: %v", err)
+	}
+	commit, err := r.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("getting head commit: %v", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("getting head tree: %v", err)
+	}
+	return tree, nil
+}
+
+// baseTree of the local base branch, as fetched: the sync branch may have diverged from it.
+func (r *Repository) baseTree() (*object.Tree, error) {
+	baseBranchName, err := r.GetBaseBranchName()
+	if err != nil {
+		return nil, err
+	}
+	ref, err := r.repo.Reference(plumbing.NewBranchReferenceName(baseBranchName), true)
+	if err != nil {
+		return nil, fmt.Errorf("getting base branch ref: %v", err)
+	}
+	commit, err := r.repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("getting base commit: %v", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("getting base tree: %v", err)
+	}
+	return tree, nil
+}
+
+// ReadFileChange of the local file at absPath, which is at filePath in the repository.
+func ReadFileChange(absPath, filePath string) (FileChange, error) {
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return FileChange{}, fmt.Errorf("reading %s: %v", filePath, err)
+	}
+	change := FileChange{Path: filePath, Mode: RegularMode}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(absPath)
+		if err != nil {
+			return FileChange{}, fmt.Errorf("reading link %s: %v", filePath, err)
+		}
+		change.Content = []byte(target)
+		change.Mode = SymlinkMode
+		return change, nil
+	case info.Mode()&0o111 != 0:
+		change.Mode = ExecutableMode
+	}
+	change.Content, err = os.ReadFile(absPath)
+	if err != nil {
+		return FileChange{}, fmt.Errorf("reading %s: %v", filePath, err)
+	}
+	return change, nil
+}
+
+// IsSymlink returns true if the change is a symbolic link, its content being the link target.
+func (c FileChange) IsSymlink() bool {
+	return c.Mode == SymlinkMode
+}
+
+// Hash of the change content as a git blob, as computed by git hash-object.
+func (c FileChange) Hash() string {
+	return plumbing.ComputeHash(plumbing.BlobObject, c.Content).String()
+}
+
+// TreeEntry of a file in a remote repository tree.
+type TreeEntry struct {
+	Hash string // blob hash
+	Mode string // git file mode
+}
+
+// remoteMoved returns true if the remote branch head is not the one fetched, or if it exists while it was not fetched.
+func (r *Repository) remoteMoved(ctx context.Context, branchName string) (bool, error) {
+	var fetched plumbing.Hash
+	remoteRef, err := r.repo.Reference(plumbing.NewRemoteReferenceName("origin", branchName), true)
+	if err == nil {
+		fetched = remoteRef.Hash()
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return false, err
+	}
+
+	remote, err := r.repo.Remote("origin")
+	if err != nil {
+		return false, err
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: r.auth})
+	if err != nil {
+		return false, err
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.NewBranchReferenceName(branchName) {
+			return ref.Hash() != fetched, nil
+		}
+	}
+	return !fetched.IsZero(), nil
+}
+
 // ChangesDetected returns true if the git status command returns elements.
 func (r *Repository) ChangeDetected() (bool, error) {
-	statuses, err := r.workTree.Status()
+	statuses, err := r.status()
 	if err != nil {
-		return false, fmt.Errorf("getting status: %v", err)
+		return false, err
 	}
 	// return true if statuses is non-zero.
 	return (len(statuses) > 0), nil
 }
 
+// status of the work tree, restricted to the sparse paths if any:
+// files outside of them are not checked out and seen as deleted.
+func (r *Repository) status() (git.Status, error) {
+	statuses, err := r.workTree.Status()
+	if err != nil {
+		return nil, fmt.Errorf("getting status: %v", err)
+	}
+	if len(r.sparsePaths) == 0 {
+		return statuses, nil
+	}
+	for filePath := range statuses {
+		if !r.isInSparsePaths(filePath) {
+			delete(statuses, filePath)
+		}
+	}
+	return statuses, nil
+}
+
+// stage all changes of the work tree, restricted to the sparse paths if any.
+func (r *Repository) stage() error {
+	if len(r.sparsePaths) == 0 {
+		opt := git.AddOptions{
+			All:  true,
+			Path: r.localPath,
+		}
+		if err := r.workTree.AddWithOptions(&opt); err != nil {
+			return fmt.Errorf("adding: %v", err)
+		}
+		return nil
+	}
+	statuses, err := r.status()
+	if err != nil {
+		return err
+	}
+	for filePath := range statuses {
+		if _, err := r.workTree.Add(filePath); err != nil {
+			return fmt.Errorf("adding %s: %v", filePath, err)
+		}
+	}
+	return nil
+}
+
+func (r *Repository) isInSparsePaths(filePath string) bool {
+	for _, p := range r.sparsePaths {
+		if strings.HasPrefix(filePath, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchBranch from the origin remote, with the clone depth.
+func (r *Repository) fetchBranch(ctx context.Context, branchName string) error {
+	refSpec := config.RefSpec(fmt.Sprintf(
+		"+%s:%s",
+		plumbing.NewBranchReferenceName(branchName), plumbing.NewRemoteReferenceName("origin", branchName),
+	))
+	err := r.repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{refSpec},
+		Depth:      r.depth,
+		Auth:       r.auth,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("fetching %s: %v", branchName, err)
+	}
+	return nil
+}
+
+// Clean the local clone, or release it if cached.
 func (r *Repository) Clean() error {
+	if r.cached {
+		if r.unlock == nil {
+			return nil
+		}
+		err := r.unlock()
+		r.unlock = nil
+		return err
+	}
 	return os.RemoveAll(r.localPath)
 }
 
+// SetupLocalBaseBranch to commit directly on the base branch: it becomes the sync branch.
+func (r *Repository) SetupLocalBaseBranch() error {
+	baseBranchName, err := r.GetBaseBranchName()
+	if err != nil {
+		return err
+	}
+	r.syncBranchName = baseBranchName
+	r.syncRef, err = r.repo.Reference(plumbing.NewBranchReferenceName(baseBranchName), true)
+	if err != nil {
+		return fmt.Errorf("getting base branch ref: %v", err)
+	}
+	// init the work tree
+	r.workTree, err = r.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("getting worktree: %v", err)
+	}
+	// checkout the base branch in the work tree
+	co := &git.CheckoutOptions{Branch: r.syncRef.Name(), SparseCheckoutDirectories: r.sparsePaths}
+	if err := r.workTree.Checkout(co); err != nil {
+		return fmt.Errorf("checkout %s: %v", r.syncRef.String(), err)
+	}
+	return nil
+}
+
 // SetupLocalSyncBranch performs low level git operations to setup sync branch,
 // it handles it either a remote branch already exist or if it should be created.
-func (r *Repository) SetupLocalSyncBranch(isNewBranch bool) error {
+func (r *Repository) SetupLocalSyncBranch(ctx context.Context, isNewBranch bool) error {
 	branchConfig := &config.Branch{
 		Name:   r.syncBranchName,
 		Rebase: "true",
@@ -172,6 +627,10 @@ func (r *Repository) SetupLocalSyncBranch(isNewBranch bool) error {
 		r.syncRef = plumbing.NewSymbolicReference(syncBranchRefName, headRef.Name())
 		branchConfig.Merge = r.syncRef.Name()
 	} else { // b
+		// only the default branch has been cloned
+		if err := r.fetchBranch(ctx, r.syncBranchName); err != nil {
+			return err
+		}
 		remoteRefName := plumbing.NewRemoteReferenceName("origin", r.syncBranchName)
 		r.syncRef = plumbing.NewSymbolicReference(syncBranchRefName, remoteRefName)
 		branchConfig.Merge = r.syncRef.Name()
@@ -193,7 +652,7 @@ func (r *Repository) SetupLocalSyncBranch(isNewBranch bool) error {
 		return fmt.Errorf("creating remote branch: %v", err)
 	}
 	// checkout the sync ref in the work tree
-	co := &git.CheckoutOptions{Branch: r.syncRef.Name()}
+	co := &git.CheckoutOptions{Branch: r.syncRef.Name(), SparseCheckoutDirectories: r.sparsePaths}
 	if err := r.workTree.Checkout(co); err != nil {
 		return fmt.Errorf("checkout %s: %v", r.syncRef.String(), err)
 	}
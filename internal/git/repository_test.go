@@ -0,0 +1,178 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// initRepo in a temporary directory.
+func initRepo(t *testing.T) (*git.Repository, string) {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("initing repository: %v", err)
+	}
+	return repo, dir
+}
+
+// commitFiles written in the work tree of the repository, by path: a nil content removes the file.
+func commitFiles(t *testing.T, repo *git.Repository, files map[string][]byte) plumbing.Hash {
+	t.Helper()
+	workTree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("getting worktree: %v", err)
+	}
+	root := workTree.Filesystem.Root()
+	for filePath, content := range files {
+		absPath := filepath.Join(root, filepath.FromSlash(filePath))
+		if content == nil {
+			if _, err := workTree.Remove(filePath); err != nil {
+				t.Fatalf("removing %s: %v", filePath, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(absPath), 0o755); err != nil {
+			t.Fatalf("creating directory of %s: %v", filePath, err)
+		}
+		if err := os.WriteFile(absPath, content, 0o644); err != nil {
+			t.Fatalf("writing %s: %v", filePath, err)
+		}
+		if _, err := workTree.Add(filePath); err != nil {
+			t.Fatalf("adding %s: %v", filePath, err)
+		}
+	}
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	hash, err := workTree.Commit("test", &git.CommitOptions{Author: signature, Committer: signature})
+	if err != nil {
+		t.Fatalf("committing: %v", err)
+	}
+	return hash
+}
+
+func TestRemoteMoved(t *testing.T) {
+	origin, originDir := initRepo(t)
+	commitFiles(t, origin, map[string][]byte{"a": []byte("1")})
+	head, err := origin.Head()
+	if err != nil {
+		t.Fatalf("getting head: %v", err)
+	}
+	branchName := head.Name().Short()
+
+	clone, err := git.PlainClone(t.TempDir(), false, &git.CloneOptions{URL: originDir})
+	if err != nil {
+		t.Fatalf("cloning: %v", err)
+	}
+	r := &Repository{repo: clone}
+	ctx := context.Background()
+
+	if moved, err := r.remoteMoved(ctx, branchName); err != nil || moved {
+		t.Errorf("fetched branch: got %v, %v, want not moved", moved, err)
+	}
+	if moved, err := r.remoteMoved(ctx, "missing"); err != nil || moved {
+		t.Errorf("missing branch: got %v, %v, want not moved", moved, err)
+	}
+
+	commitFiles(t, origin, map[string][]byte{"a": []byte("2")})
+	if moved, err := r.remoteMoved(ctx, branchName); err != nil || !moved {
+		t.Errorf("new remote commit: got %v, %v, want moved", moved, err)
+	}
+
+	if err := origin.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("created"), head.Hash())); err != nil {
+		t.Fatalf("creating branch: %v", err)
+	}
+	if moved, err := r.remoteMoved(ctx, "created"); err != nil || !moved {
+		t.Errorf("branch created on the remote: got %v, %v, want moved", moved, err)
+	}
+}
+
+func TestGetBaseBranchName(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultBranch string
+		cached        bool
+	}{
+		{name: "main", defaultBranch: "main"},
+		{name: "other default branch", defaultBranch: "develop"},
+		{name: "cached clone", defaultBranch: "develop", cached: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin, originDir := initRepo(t)
+			commitFiles(t, origin, map[string][]byte{"a": []byte("1")})
+			head, err := origin.Head()
+			if err != nil {
+				t.Fatalf("getting head: %v", err)
+			}
+			for _, name := range []string{"main", tt.defaultBranch} {
+				ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName(name), head.Hash())
+				if err := origin.Storer.SetReference(ref); err != nil {
+					t.Fatalf("creating branch %s: %v", name, err)
+				}
+			}
+			defaultRef := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(tt.defaultBranch))
+			if err := origin.Storer.SetReference(defaultRef); err != nil {
+				t.Fatalf("setting default branch: %v", err)
+			}
+
+			localPath := filepath.Join(t.TempDir(), "clone")
+			opt := CloneOptions{Cached: tt.cached}
+			r, err := NewRepository(context.Background(), localPath, originDir, "sync", nil, Identity{}, Identity{}, opt)
+			if err != nil {
+				t.Fatalf("NewRepository() error = %v", err)
+			}
+			if tt.cached {
+				// release then reuse the cached clone
+				if err := r.Clean(); err != nil {
+					t.Fatalf("releasing the clone: %v", err)
+				}
+				if r, err = NewRepository(context.Background(), localPath, originDir, "sync", nil, Identity{}, Identity{}, opt); err != nil {
+					t.Fatalf("NewRepository() reusing the clone error = %v", err)
+				}
+			}
+			t.Cleanup(func() { _ = r.Clean() })
+
+			if got, err := r.GetBaseBranchName(); err != nil || got != tt.defaultBranch {
+				t.Errorf("GetBaseBranchName() = %s, %v, want %s", got, err, tt.defaultBranch)
+			}
+		})
+	}
+}
+
+func TestListBaseFiles(t *testing.T) {
+	repo, _ := initRepo(t)
+	head := commitFiles(t, repo, map[string][]byte{"a.txt": []byte("a"), "dir/b.txt": []byte("b")})
+	base, err := repo.Head()
+	if err != nil {
+		t.Fatalf("getting head: %v", err)
+	}
+
+	// the sync branch diverges from the base branch
+	syncRefName := plumbing.NewBranchReferenceName("sync")
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(syncRefName, head)); err != nil {
+		t.Fatalf("creating sync branch: %v", err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, syncRefName)); err != nil {
+		t.Fatalf("checking out sync branch: %v", err)
+	}
+	commitFiles(t, repo, map[string][]byte{"a.txt": nil, "c.txt": []byte("c")})
+
+	r := &Repository{repo: repo, baseBranchName: base.Name().Short()}
+	got, err := r.ListBaseFiles()
+	if err != nil {
+		t.Fatalf("ListBaseFiles() error = %v", err)
+	}
+	sort.Strings(got)
+	if want := []string{"a.txt", "dir/b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("ListBaseFiles() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package git
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	"golang.org/x/crypto/ssh"
+)
+
+// NewGPGSigner to sign commits with an armored GPG private key, given as a path or a content.
+// The passphrase is only required for encrypted keys.
+func NewGPGSigner(privateKey, passphrase string) (git.Signer, error) {
+	keyBytes, err := readKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("reading gpg key: %v", err)
+	}
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("no gpg key found")
+	}
+	entity := entities[0]
+	if entity.PrivateKey == nil {
+		return nil, fmt.Errorf("gpg key has no private key")
+	}
+	if entity.PrivateKey.Encrypted {
+		if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("decrypting gpg key: %v", err)
+		}
+	}
+	return gpgSigner{entity: entity}, nil
+}
+
+// NewSSHSigner to sign commits with an ssh private key, given as a path or a content.
+// The passphrase is only required for encrypted keys.
+func NewSSHSigner(privateKey, passphrase string) (git.Signer, error) {
+	keyBytes, err := readKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing ssh key: %v", err)
+	}
+	return sshSigner{signer: signer}, nil
+}
+
+// gpgSigner produces armored detached signatures, as done by `git commit -S`.
+type gpgSigner struct {
+	entity *openpgp.Entity
+}
+
+func (s gpgSigner) Sign(message io.Reader) ([]byte, error) {
+	var b bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&b, s.entity, message, nil); err != nil {
+		return nil, fmt.Errorf("signing with gpg: %v", err)
+	}
+	return b.Bytes(), nil
+}
+
+// sshSigner produces armored SSHSIG signatures in the git namespace, as done by `git commit -S` with gpg.format=ssh.
+// Format: https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+const (
+	sshSigMagic         = "SSHSIG"
+	sshSigVersion       = 1
+	sshSigNamespace     = "git"
+	sshSigHashAlgorithm = "sha512"
+	sshSigLineLength    = 70
+)
+
+func (s sshSigner) Sign(message io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, fmt.Errorf("hashing message: %v", err)
+	}
+
+	// sign the wrapped hash of the message
+	signedData := []byte(sshSigMagic)
+	signedData = appendSSHString(signedData, []byte(sshSigNamespace))
+	signedData = appendSSHString(signedData, nil) // reserved
+	signedData = appendSSHString(signedData, []byte(sshSigHashAlgorithm))
+	signedData = appendSSHString(signedData, h.Sum(nil))
+	var signature *ssh.Signature
+	var err error
+	if algorithmSigner, ok := s.signer.(ssh.AlgorithmSigner); ok && s.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// ssh-rsa (sha1) signatures are refused by git: use sha512
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, signedData, ssh.KeyAlgoRSASHA512)
+	} else {
+		signature, err = s.signer.Sign(rand.Reader, signedData)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing with ssh: %v", err)
+	}
+
+	// build the signature blob
+	blob := []byte(sshSigMagic)
+	blob = binary.BigEndian.AppendUint32(blob, sshSigVersion)
+	blob = appendSSHString(blob, s.signer.PublicKey().Marshal())
+	blob = appendSSHString(blob, []byte(sshSigNamespace))
+	blob = appendSSHString(blob, nil) // reserved
+	blob = appendSSHString(blob, []byte(sshSigHashAlgorithm))
+	blob = appendSSHString(blob, ssh.Marshal(signature))
+
+	// armor it
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	var armored strings.Builder
+	armored.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > sshSigLineLength {
+		armored.WriteString(encoded[:sshSigLineLength] + "\n")
+		encoded = encoded[sshSigLineLength:]
+	}
+	armored.WriteString(encoded + "\n")
+	armored.WriteString("-----END SSH SIGNATURE-----\n")
+	return []byte(armored.String()), nil
+}
+
+// appendSSHString encodes b as an ssh wire string: length prefixed.
+func appendSSHString(dst, b []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(b)))
+	return append(dst, b...)
+}
+
+// readKey content, from a file if the given key is an existing path.
+func readKey(key string) ([]byte, error) {
+	if _, err := os.Stat(key); err != nil {
+		return []byte(key), nil //nolint:nilerr // not a path: the key is the content
+	}
+	keyBytes, err := os.ReadFile(key)
+	if err != nil {
+		return nil, fmt.Errorf("reading key: %v", err)
+	}
+	return keyBytes, nil
+}
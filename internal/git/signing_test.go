@@ -0,0 +1,151 @@
+package git
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHSigner(t *testing.T) {
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating ed25519 key: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating rsa key: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		privateKey any
+		passphrase string
+		algorithm  string
+	}{
+		{name: "ed25519", privateKey: ed25519Key, algorithm: ssh.KeyAlgoED25519},
+		{name: "rsa signed with sha512", privateKey: rsaKey, algorithm: ssh.KeyAlgoRSASHA512},
+		{name: "encrypted", privateKey: ed25519Key, passphrase: "secret", algorithm: ssh.KeyAlgoED25519},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var block *pem.Block
+			if tt.passphrase == "" {
+				block, err = ssh.MarshalPrivateKey(tt.privateKey, "")
+			} else {
+				block, err = ssh.MarshalPrivateKeyWithPassphrase(tt.privateKey, "", []byte(tt.passphrase))
+			}
+			if err != nil {
+				t.Fatalf("marshaling key: %v", err)
+			}
+			signer, err := NewSSHSigner(string(pem.EncodeToMemory(block)), tt.passphrase)
+			if err != nil {
+				t.Fatalf("NewSSHSigner() error = %v", err)
+			}
+
+			message := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\ncommit message\n"
+			armored, err := signer.Sign(strings.NewReader(message))
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			verifySSHSig(t, armored, []byte(message), tt.algorithm)
+		})
+	}
+}
+
+func TestNewSSHSignerErrors(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte("secret"))
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		privateKey string
+		passphrase string
+	}{
+		{name: "not a key", privateKey: "not a key"},
+		{name: "missing passphrase", privateKey: string(pem.EncodeToMemory(block))},
+		{name: "wrong passphrase", privateKey: string(pem.EncodeToMemory(block)), passphrase: "wrong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSSHSigner(tt.privateKey, tt.passphrase); err == nil {
+				t.Errorf("NewSSHSigner() error = nil, want an error")
+			}
+		})
+	}
+}
+
+// verifySSHSig armored signature of the message, as done by `ssh-keygen -Y verify -n git`.
+func verifySSHSig(t *testing.T, armored, message []byte, algorithm string) {
+	t.Helper()
+	const begin, end = "-----BEGIN SSH SIGNATURE-----\n", "-----END SSH SIGNATURE-----\n"
+	if !bytes.HasPrefix(armored, []byte(begin)) || !bytes.HasSuffix(armored, []byte(end)) {
+		t.Fatalf("signature is not armored:\n%s", armored)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(armored[len(begin):len(armored)-len(end)]), "\n"), "\n")
+	for _, line := range lines {
+		if len(line) > sshSigLineLength {
+			t.Errorf("armored line longer than %d: %s", sshSigLineLength, line)
+		}
+	}
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+	if err != nil {
+		t.Fatalf("decoding signature: %v", err)
+	}
+
+	if !bytes.HasPrefix(blob, []byte(sshSigMagic)) {
+		t.Fatalf("signature has no %s magic", sshSigMagic)
+	}
+	rest := blob[len(sshSigMagic):]
+	if version := binary.BigEndian.Uint32(rest); version != sshSigVersion {
+		t.Errorf("version = %d, want %d", version, sshSigVersion)
+	}
+	rest = rest[4:]
+	var fields [5][]byte // public key, namespace, reserved, hash algorithm, signature
+	for i := range fields {
+		length := binary.BigEndian.Uint32(rest)
+		fields[i], rest = rest[4:4+length], rest[4+length:]
+	}
+	if len(rest) != 0 {
+		t.Errorf("%d trailing bytes in signature", len(rest))
+	}
+	if string(fields[1]) != sshSigNamespace || string(fields[3]) != sshSigHashAlgorithm {
+		t.Errorf("namespace, hash algorithm = %s, %s, want %s, %s", fields[1], fields[3], sshSigNamespace, sshSigHashAlgorithm)
+	}
+
+	publicKey, err := ssh.ParsePublicKey(fields[0])
+	if err != nil {
+		t.Fatalf("parsing public key: %v", err)
+	}
+	signature := new(ssh.Signature)
+	if err := ssh.Unmarshal(fields[4], signature); err != nil {
+		t.Fatalf("parsing signature: %v", err)
+	}
+	if signature.Format != algorithm {
+		t.Errorf("signature format = %s, want %s", signature.Format, algorithm)
+	}
+
+	h := sha512.Sum512(message)
+	signedData := []byte(sshSigMagic)
+	signedData = appendSSHString(signedData, []byte(sshSigNamespace))
+	signedData = appendSSHString(signedData, nil)
+	signedData = appendSSHString(signedData, []byte(sshSigHashAlgorithm))
+	signedData = appendSSHString(signedData, h[:])
+	if err := publicKey.Verify(signedData, signature); err != nil {
+		t.Errorf("verifying signature: %v", err)
+	}
+}
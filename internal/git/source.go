@@ -0,0 +1,342 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gha-file-sync/internal/log"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// CloneSource repository of bindings at the given ref, the default branch if empty, and returns the checked out commit hash.
+// The ref is a branch or a tag, cloned shallow unless the whole history is required,
+// or a commit hash which always requires the whole history.
+func CloneSource(ctx context.Context, localPath, repoURL, ref string, auth transport.AuthMethod, fullHistory bool) (string, error) {
+	if err := os.RemoveAll(localPath); err != nil {
+		return "", fmt.Errorf("cleaning %s: %v", localPath, err)
+	}
+
+	opt := &git.CloneOptions{URL: repoURL, Auth: auth, Depth: 1, SingleBranch: true}
+	if fullHistory {
+		opt.Depth = 0
+	}
+	var hash plumbing.Hash
+	if ref != "" {
+		refName, err := resolveRemoteRef(ctx, repoURL, ref, auth)
+		if err != nil {
+			return "", err
+		}
+		if refName != "" {
+			opt.ReferenceName = refName
+		} else if plumbing.IsHash(ref) {
+			opt = &git.CloneOptions{URL: repoURL, Auth: auth, NoCheckout: true}
+			hash = plumbing.NewHash(ref)
+		} else {
+			return "", fmt.Errorf("ref %s not found in %s", ref, repoURL)
+		}
+	}
+
+	isBare := false
+	repo, err := git.PlainCloneContext(ctx, localPath, isBare, opt)
+	if err != nil {
+		return "", fmt.Errorf("cloning: %v", err)
+	}
+	if !hash.IsZero() {
+		workTree, err := repo.Worktree()
+		if err != nil {
+			return "", fmt.Errorf("getting worktree: %v", err)
+		}
+		if err := workTree.Checkout(&git.CheckoutOptions{Hash: hash}); err != nil {
+			return "", fmt.Errorf("checkout %s: %v", ref, err)
+		}
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("getting head: %v", err)
+	}
+	return head.Hash().String(), nil
+}
+
+// resolveRemoteRef name of a branch, or else a tag, of the remote repository: empty if none.
+func resolveRemoteRef(ctx context.Context, repoURL, ref string, auth transport.AuthMethod) (plumbing.ReferenceName, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{repoURL}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("listing remote refs: %v", err)
+	}
+	var tagName plumbing.ReferenceName
+	for _, r := range refs {
+		switch r.Name() {
+		case plumbing.NewBranchReferenceName(ref):
+			return r.Name(), nil
+		case plumbing.NewTagReferenceName(ref):
+			tagName = r.Name()
+		}
+	}
+	return tagName, nil
+}
+
+// LastAuthors of the given paths, relative to sourcePath which is in a git repository, at the given ref or the head:
+// the author of the last commit having touched each path, without duplicates.
+// Paths without history, for instance in shallow clones, are ignored.
+func LastAuthors(sourcePath, ref string, paths []string) ([]Identity, error) {
+	repo, root, err := openSource(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := resolveCommit(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	authors := []Identity{}
+	for _, p := range paths {
+		relPath, err := repoPath(root, sourcePath, p)
+		if err != nil {
+			return nil, err
+		}
+
+		commits, err := repo.Log(&git.LogOptions{
+			From: commit.Hash,
+			PathFilter: func(filePath string) bool {
+				return relPath == "." || filePath == relPath || strings.HasPrefix(filePath, relPath+"/")
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("getting history of %s: %v", p, err)
+		}
+		commit, err := commits.Next()
+		commits.Close()
+		if err != nil {
+			log.Warnf("no history found for %s: %v", p, err)
+			continue
+		}
+		author := Identity{Name: commit.Author.Name, Email: commit.Author.Email}
+		if !containsIdentity(authors, author) {
+			authors = append(authors, author)
+		}
+	}
+	return authors, nil
+}
+
+// FileHistory of the file at filePath, relative to sourcePath which is in a git repository:
+// its distinct contents in the commits of the head history, the latest first.
+// The whole history is required: it fails in a shallow clone.
+func FileHistory(sourcePath, filePath string) ([][]byte, error) {
+	repo, root, err := openSource(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	shallow, err := isShallow(repo)
+	if err != nil {
+		return nil, err
+	}
+	if shallow {
+		return nil, fmt.Errorf("shallow clone, the whole history of %s is required: fetch it with fetch-depth: 0", filePath)
+	}
+	head, err := resolveCommit(repo, "")
+	if err != nil {
+		return nil, err
+	}
+	relPath, err := repoPath(root, sourcePath, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := repo.Log(&git.LogOptions{
+		From:       head.Hash,
+		PathFilter: func(p string) bool { return p == relPath },
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting history of %s: %v", filePath, err)
+	}
+	defer commits.Close()
+	versions := [][]byte{}
+	seen := map[plumbing.Hash]bool{}
+	for {
+		commit, err := commits.Next()
+		if errors.Is(err, io.EOF) {
+			return versions, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting history of %s: %v", filePath, err)
+		}
+		f, err := commit.File(relPath)
+		if errors.Is(err, object.ErrFileNotFound) {
+			continue // deleted by this commit
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting %s at %s: %v", filePath, commit.Hash, err)
+		}
+		if seen[f.Hash] {
+			continue
+		}
+		seen[f.Hash] = true
+		content, err := f.Contents()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s at %s: %v", filePath, commit.Hash, err)
+		}
+		versions = append(versions, []byte(content))
+	}
+}
+
+// ExportSource files and directories at the given paths, relative to sourcePath which is in a git repository,
+// as they are in the commit the ref resolves to, into exportDir at the same relative paths.
+// It returns the commit hash.
+func ExportSource(sourcePath, ref string, paths []string, exportDir string) (string, error) {
+	repo, root, err := openSource(sourcePath)
+	if err != nil {
+		return "", err
+	}
+	commit, err := resolveCommit(repo, ref)
+	if err != nil {
+		return "", err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", fmt.Errorf("getting tree of %s: %v", ref, err)
+	}
+
+	for _, p := range paths {
+		relPath, err := repoPath(root, sourcePath, p)
+		if err != nil {
+			return "", err
+		}
+		exportPath := filepath.Join(exportDir, p)
+
+		// a directory: all its files are exported
+		subTree := tree
+		if relPath != "." {
+			entry, err := tree.FindEntry(relPath)
+			if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+				log.Warnf("%s not found at %s", p, ref)
+				continue
+			}
+			if err != nil {
+				return "", fmt.Errorf("finding %s at %s: %v", p, ref, err)
+			}
+			if entry.Mode != filemode.Dir {
+				f, err := tree.TreeEntryFile(entry)
+				if err != nil {
+					return "", fmt.Errorf("getting %s at %s: %v", p, ref, err)
+				}
+				if err := exportFile(f, exportPath); err != nil {
+					return "", err
+				}
+				continue
+			}
+			if subTree, err = tree.Tree(relPath); err != nil {
+				return "", fmt.Errorf("getting %s at %s: %v", p, ref, err)
+			}
+		}
+		err = subTree.Files().ForEach(func(f *object.File) error {
+			return exportFile(f, filepath.Join(exportPath, filepath.FromSlash(f.Name)))
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return commit.Hash.String(), nil
+}
+
+// exportFile of a git tree at the given path, with its mode: symbolic links are created as links.
+func exportFile(f *object.File, exportPath string) error {
+	if err := os.MkdirAll(filepath.Dir(exportPath), 0o755); err != nil { //nolint:gomnd
+		return err
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", f.Name, err)
+	}
+	switch f.Mode {
+	case filemode.Symlink:
+		return os.Symlink(content, exportPath)
+	case filemode.Executable:
+		return os.WriteFile(exportPath, []byte(content), 0o755) //nolint:gomnd
+	case filemode.Regular, filemode.Deprecated:
+		return os.WriteFile(exportPath, []byte(content), 0o644) //nolint:gomnd
+	default:
+		log.Warnf("skipping %s: not a regular file", f.Name)
+		return nil
+	}
+}
+
+// IsShallow tells if the repository of sourcePath is a shallow clone, missing part of its history.
+func IsShallow(sourcePath string) (bool, error) {
+	repo, _, err := openSource(sourcePath)
+	if err != nil {
+		return false, err
+	}
+	return isShallow(repo)
+}
+
+// isShallow repository: its shallow commits are missing their parents.
+func isShallow(repo *git.Repository) (bool, error) {
+	shallows, err := repo.Storer.Shallow()
+	if err != nil {
+		return false, fmt.Errorf("getting shallow commits: %v", err)
+	}
+	return len(shallows) > 0, nil
+}
+
+// openSource repository containing sourcePath, with its work tree root.
+func openSource(sourcePath string) (*git.Repository, string, error) {
+	repo, err := git.PlainOpenWithOptions(sourcePath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, "", fmt.Errorf("opening source repository: %v", err)
+	}
+	workTree, err := repo.Worktree()
+	if err != nil {
+		return nil, "", fmt.Errorf("getting source worktree: %v", err)
+	}
+	return repo, workTree.Filesystem.Root(), nil
+}
+
+// resolveCommit the ref points to, a branch, a tag or a commit hash, the head if empty.
+func resolveCommit(repo *git.Repository, ref string) (*object.Commit, error) {
+	rev := plumbing.Revision(plumbing.HEAD)
+	if ref != "" {
+		rev = plumbing.Revision(ref)
+	}
+	hash, err := repo.ResolveRevision(rev)
+	if err != nil {
+		// the ref may be missing from a shallow checkout
+		return nil, fmt.Errorf("resolving %s in the source repository, is it fetched? %v", rev, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("getting commit of %s: %v", rev, err)
+	}
+	return commit, nil
+}
+
+// repoPath of p, relative to sourcePath: relative to the repository root, with forward slashes, as in git trees.
+func repoPath(root, sourcePath, p string) (string, error) {
+	relPath, err := filepath.Rel(root, filepath.Join(sourcePath, p))
+	if err != nil {
+		return "", fmt.Errorf("getting relative path of %s: %v", p, err)
+	}
+	return filepath.ToSlash(relPath), nil
+}
+
+// containsIdentity compares identities by e-mail, case-insensitively, as done by trailer parsers.
+func containsIdentity(identities []Identity, identity Identity) bool {
+	for _, i := range identities {
+		if strings.EqualFold(i.Email, identity.Email) {
+			return true
+		}
+	}
+	return false
+}
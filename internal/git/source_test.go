@@ -0,0 +1,225 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestCloneSource(t *testing.T) {
+	origin, originDir := initRepo(t)
+	first := commitFiles(t, origin, map[string][]byte{"a.txt": []byte("1")})
+	tagRef := plumbing.NewHashReference(plumbing.NewTagReferenceName("v1"), first)
+	if err := origin.Storer.SetReference(tagRef); err != nil {
+		t.Fatalf("tagging: %v", err)
+	}
+	second := commitFiles(t, origin, map[string][]byte{"a.txt": []byte("2")})
+	branchRef := plumbing.NewHashReference(plumbing.NewBranchReferenceName("release"), first)
+	if err := origin.Storer.SetReference(branchRef); err != nil {
+		t.Fatalf("creating branch: %v", err)
+	}
+	// a branch named as the tag prevails
+	if err := origin.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("v2"), second)); err != nil {
+		t.Fatalf("creating branch: %v", err)
+	}
+	if err := origin.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName("v2"), first)); err != nil {
+		t.Fatalf("tagging: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		ref         string
+		fullHistory bool
+		wantHash    plumbing.Hash
+		wantContent string
+		wantErr     bool
+	}{
+		{name: "default branch", wantHash: second, wantContent: "2"},
+		{name: "whole history", fullHistory: true, wantHash: second, wantContent: "2"},
+		{name: "branch", ref: "release", wantHash: first, wantContent: "1"},
+		{name: "tag", ref: "v1", wantHash: first, wantContent: "1"},
+		{name: "branch before tag", ref: "v2", wantHash: second, wantContent: "2"},
+		{name: "commit hash", ref: first.String(), wantHash: first, wantContent: "1"},
+		{name: "missing ref", ref: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localPath := filepath.Join(t.TempDir(), "source")
+			got, err := CloneSource(context.Background(), localPath, originDir, tt.ref, nil, tt.fullHistory)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CloneSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.wantHash.String() {
+				t.Errorf("CloneSource() = %s, want %s", got, tt.wantHash)
+			}
+			content, err := os.ReadFile(filepath.Join(localPath, "a.txt"))
+			if err != nil || string(content) != tt.wantContent {
+				t.Errorf("checked out a.txt = %q, %v, want %q", content, err, tt.wantContent)
+			}
+			if tt.fullHistory {
+				versions, err := FileHistory(localPath, "a.txt")
+				if err != nil || len(versions) != 2 {
+					t.Errorf("FileHistory() = %q, %v, want the 2 versions", versions, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExportSource(t *testing.T) {
+	repo, dir := initRepo(t)
+	first := commitFiles(t, repo, map[string][]byte{
+		"action/a.txt":     []byte("1"),
+		"action/dir/b.txt": []byte("1"),
+		"action/run.sh":    []byte("#!/bin/sh\n"),
+	})
+	// an executable file and a symbolic link
+	workTree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("getting worktree: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "action", "run.sh"), 0o755); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "action", "link")); err != nil {
+		t.Fatalf("creating link: %v", err)
+	}
+	for _, p := range []string{"action/run.sh", "action/link"} {
+		if _, err := workTree.Add(p); err != nil {
+			t.Fatalf("adding %s: %v", p, err)
+		}
+	}
+	second := commitFiles(t, repo, map[string][]byte{"action/a.txt": []byte("2"), "action/dir/b.txt": []byte("2")})
+	sourcePath := filepath.Join(dir, "action")
+
+	tests := []struct {
+		name      string
+		ref       string
+		paths     []string
+		wantHash  plumbing.Hash
+		wantFiles map[string]string // content by path, "->" prefixing a link target
+		wantModes map[string]os.FileMode
+		wantErr   bool
+	}{
+		{
+			name: "file and directory at a commit", ref: first.String(), paths: []string{"a.txt", "dir"}, wantHash: first,
+			wantFiles: map[string]string{"a.txt": "1", "dir/b.txt": "1"},
+		},
+		{
+			name: "head", paths: []string{"a.txt", "dir/", "run.sh", "link"}, wantHash: second,
+			wantFiles: map[string]string{"a.txt": "2", "dir/b.txt": "2", "run.sh": "#!/bin/sh\n", "link": "->a.txt"},
+			wantModes: map[string]os.FileMode{"a.txt": 0o644, "run.sh": 0o755},
+		},
+		{
+			name: "whole source", ref: "HEAD", paths: []string{"."}, wantHash: second,
+			wantFiles: map[string]string{"a.txt": "2", "dir/b.txt": "2", "run.sh": "#!/bin/sh\n", "link": "->a.txt"},
+		},
+		{
+			name: "missing path skipped", ref: first.String(), paths: []string{"link", "a.txt"}, wantHash: first,
+			wantFiles: map[string]string{"a.txt": "1"},
+		},
+		{name: "missing ref", ref: "missing", paths: []string{"a.txt"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exportDir := t.TempDir()
+			got, err := ExportSource(sourcePath, tt.ref, tt.paths, exportDir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExportSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.wantHash.String() {
+				t.Errorf("ExportSource() = %s, want %s", got, tt.wantHash)
+			}
+
+			gotFiles := map[string]string{}
+			err = filepath.WalkDir(exportDir, func(p string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				relPath, _ := filepath.Rel(exportDir, p)
+				if d.Type()&os.ModeSymlink != 0 {
+					target, err := os.Readlink(p)
+					gotFiles[filepath.ToSlash(relPath)] = "->" + target
+					return err
+				}
+				content, err := os.ReadFile(p)
+				gotFiles[filepath.ToSlash(relPath)] = string(content)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("reading exported files: %v", err)
+			}
+			if !reflect.DeepEqual(gotFiles, tt.wantFiles) {
+				t.Errorf("exported files = %v, want %v", gotFiles, tt.wantFiles)
+			}
+			for p, want := range tt.wantModes {
+				info, err := os.Stat(filepath.Join(exportDir, p))
+				if err != nil {
+					t.Fatalf("stat %s: %v", p, err)
+				}
+				if info.Mode().Perm() != want {
+					t.Errorf("mode of %s = %v, want %v", p, info.Mode().Perm(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		subDir   string // of the source path in the repository
+		filePath string
+		shallow  bool
+		want     []string
+		wantErr  bool
+	}{
+		{name: "distinct versions, latest first", filePath: "a.txt", want: []string{"3", "1", "2"}},
+		{name: "deleted then restored", filePath: "b.txt", want: []string{"b"}},
+		{name: "relative to the source path", subDir: "sub", filePath: "../a.txt", want: []string{"3", "1", "2"}},
+		{name: "never committed", filePath: "missing.txt", want: []string{}},
+		{name: "shallow clone", filePath: "a.txt", shallow: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, dir := initRepo(t)
+			first := commitFiles(t, repo, map[string][]byte{"a.txt": []byte("1"), "b.txt": []byte("b")})
+			commitFiles(t, repo, map[string][]byte{"a.txt": []byte("2"), "b.txt": nil})
+			commitFiles(t, repo, map[string][]byte{"a.txt": []byte("1"), "b.txt": []byte("b")})
+			commitFiles(t, repo, map[string][]byte{"a.txt": []byte("3")})
+			if tt.shallow {
+				if err := repo.Storer.SetShallow([]plumbing.Hash{first}); err != nil {
+					t.Fatalf("setting shallow commits: %v", err)
+				}
+			}
+			if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+				t.Fatalf("creating directory: %v", err)
+			}
+
+			got, err := FileHistory(filepath.Join(dir, tt.subDir), tt.filePath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FileHistory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			versions := []string{}
+			for _, v := range got {
+				versions = append(versions, string(v))
+			}
+			if !reflect.DeepEqual(versions, tt.want) {
+				t.Errorf("FileHistory() = %q, want %q", versions, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package git
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// sshUser used by all the supported git hosts.
+const sshUser = "git"
+
+// NewSSHAuth builds the authentication method for git operations over ssh.
+// The private key is either a file path or a PEM encoded content. If empty, the ssh agent is used.
+// Host keys are always verified against the given known_hosts files, or the default ones if none is given.
+func NewSSHAuth(privateKey, passphrase string, knownHostsFiles []string) (transport.AuthMethod, error) {
+	hostKeyCallback, err := ssh.NewKnownHostsCallback(knownHostsFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("loading known hosts: %v", err)
+	}
+
+	// agent mode
+	if privateKey == "" {
+		auth, err := ssh.NewSSHAgentAuth(sshUser)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to ssh agent: %v", err)
+		}
+		auth.HostKeyCallback = hostKeyCallback
+		return auth, nil
+	}
+
+	// private key mode: consider it is a path if the file exists
+	pemBytes := []byte(privateKey)
+	if _, err := os.Stat(privateKey); err == nil {
+		if pemBytes, err = os.ReadFile(privateKey); err != nil {
+			return nil, fmt.Errorf("reading private key: %v", err)
+		}
+	}
+	auth, err := ssh.NewPublicKeys(sshUser, pemBytes, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %v", err)
+	}
+	auth.HostKeyCallback = hostKeyCallback
+	return auth, nil
+}
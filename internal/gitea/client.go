@@ -0,0 +1,124 @@
+package gitea
+
+import (
+	"context"
+	"fmt"
+
+	"gha-file-sync/internal/git"
+	"gha-file-sync/internal/log"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// Client for gitea, also compatible with forgejo which exposes the same API.
+type Client struct {
+	*gitea.Client
+
+	hostURL string
+	token   string
+}
+
+// NewClient for gitea with authentication configured.
+// The API is expected at https://{hostURL}/api/v1/.
+func NewClient(ctx context.Context, giteaToken, hostURL string) (*Client, error) {
+	c, err := gitea.NewClient(
+		fmt.Sprintf("https://%s", hostURL),
+		gitea.SetToken(giteaToken),
+		gitea.SetContext(ctx),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating gitea client: %v", err)
+	}
+	return &Client{Client: c, hostURL: hostURL, token: giteaToken}, nil
+}
+
+// GetAuthenticatedUser return the identity of the current authenticated user.
+// The e-mail is the one of the user profile, which is a noreply address if the user keeps it private.
+func (c Client) GetAuthenticatedUser(ctx context.Context) (git.Identity, error) {
+	user, _, err := c.Client.GetMyUserInfo()
+	if err != nil {
+		return git.Identity{}, fmt.Errorf("getting user: %v", err)
+	}
+	if user == nil || user.UserName == "" {
+		return git.Identity{}, fmt.Errorf("retrieved an empty user")
+	}
+	identity := git.Identity{Name: user.FullName, Email: user.Email}
+	if identity.Name == "" {
+		identity.Name = user.UserName
+	}
+	return identity, nil
+}
+
+// GetHeadBranchNameByPRNumbers for a given repository as a map. Consider only opened PRs.
+func (c Client) GetHeadBranchNameByPRNumbers(ctx context.Context, owner, repoName string) (map[int]string, error) {
+	// max page size is defined by the instance, 50 by default: https://docs.gitea.com/administration/config-cheat-sheet#api-api
+	opt := gitea.ListPullRequestsOptions{State: gitea.StateOpen, ListOptions: gitea.ListOptions{PageSize: 50}}
+
+	prs, _, err := c.Client.ListRepoPullRequests(owner, repoName, opt)
+	if err != nil {
+		return nil, fmt.Errorf("listing prs: %v", err)
+	}
+
+	// log a warning if the number of PR retrieved is the maximum page size
+	if len(prs) == 50 { //nolint:gomnd
+		log.Warnf("50 opened PRs on this repository, this may make the synchronization to fail")
+	}
+
+	headBranchNameByPRNumbers := make(map[int]string, len(prs))
+	for _, pr := range prs {
+		if pr.Head != nil && pr.Head.Ref != "" {
+			headBranchNameByPRNumbers[int(pr.Index)] = pr.Head.Ref
+		}
+	}
+	return headBranchNameByPRNumbers, nil
+}
+
+// CreateOrUpdatePR according to the existingPRNumber parameter.
+// On update, the desc is added to the Pull Request as a comment.
+func (c Client) CreateOrUpdatePR(
+	ctx context.Context, existingPRNumber *int,
+	owner, repoName,
+	baseBranch, headBranch,
+	title, desc string,
+) error {
+	if existingPRNumber == nil { // create mode
+		pr := gitea.CreatePullRequestOption{
+			Title: title,
+			Base:  baseBranch,
+			Head:  headBranch,
+			Body:  desc,
+		}
+		createdPR, _, err := c.Client.CreatePullRequest(owner, repoName, pr)
+		if err != nil {
+			return fmt.Errorf("creating PR: %v", err)
+		}
+		log.Infof("PR created: %s", createdPR.HTMLURL)
+	} else { // update mode = create a comment with the given desc
+		desc = fmt.Sprintf("PR updated with additional changes: %s", desc)
+		prComment, _, err := c.Client.CreateIssueComment(owner, repoName, int64(*existingPRNumber), gitea.CreateIssueCommentOption{
+			Body: desc,
+		})
+		if err != nil {
+			return fmt.Errorf("creating comment on PR: %v", err)
+		}
+		log.Infof("PR updated: %s", prComment.HTMLURL)
+	}
+	return nil
+}
+
+// GetRepoURL to clone the repository over https.
+func (c Client) GetRepoURL(owner, repoName string) string {
+	return fmt.Sprintf("https://%s/%s/%s.git", c.hostURL, owner, repoName)
+}
+
+// GetSSHRepoURL to clone the repository over ssh.
+func (c Client) GetSSHRepoURL(owner, repoName string) string {
+	return fmt.Sprintf("git@%s:%s/%s.git", c.hostURL, owner, repoName)
+}
+
+// GitAuth returns the authentication method to use for git operations over https.
+func (c Client) GitAuth() http.AuthMethod {
+	// the token is accepted as username with any password
+	return &http.BasicAuth{Username: c.token, Password: "x-oauth-basic"}
+}
@@ -0,0 +1,161 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// a github app JWT can live 10 minutes maximum, keep a margin for clock drifts
+	appJWTLifetime = 9 * time.Minute
+	// refresh tokens a bit before they actually expire so long git operations don't fail
+	tokenRefreshMargin = 5 * time.Minute
+)
+
+// app holds the configuration of a github app and a client authenticated as the app itself.
+type app struct {
+	id             int64
+	installationID int64 // 0 means the installation is discovered per owner
+	client         *github.Client
+
+	hostURL string
+	// github enterprise server endpoints, empty for github.com
+	apiURL    string
+	uploadURL string
+
+	// installations discovered per owner, lowercase: their clients are reused for all the repositories of the owner
+	installations map[string]*Client
+}
+
+// jwtTokenSource mints JSON Web Tokens authenticating as a github app.
+type jwtTokenSource struct {
+	appID      int64
+	privateKey *rsa.PrivateKey
+}
+
+// Token signs a new JWT for the app: https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app
+func (s jwtTokenSource) Token() (*oauth2.Token, error) {
+	// issued 60 seconds in the past to allow for clock drift
+	now := time.Now()
+	issuedAt := now.Add(-time.Minute)
+	expiresAt := now.Add(appJWTLifetime)
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return nil, fmt.Errorf("marshalling jwt header: %v", err)
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": issuedAt.Unix(),
+		"exp": expiresAt.Unix(),
+		"iss": strconv.FormatInt(s.appID, 10),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshalling jwt claims: %v", err)
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("signing jwt: %v", err)
+	}
+	return &oauth2.Token{
+		AccessToken: unsigned + "." + base64.RawURLEncoding.EncodeToString(signature),
+		TokenType:   "Bearer",
+		Expiry:      expiresAt,
+	}, nil
+}
+
+// installationTokenSource mints installation access tokens using the app client.
+type installationTokenSource struct {
+	ctx            context.Context //nolint:containedctx // oauth2.TokenSource does not take any context
+	appClient      *github.Client
+	installationID int64
+}
+
+// Token creates a new installation access token, valid for one hour.
+func (s installationTokenSource) Token() (*oauth2.Token, error) {
+	installationToken, resp, err := s.appClient.Apps.CreateInstallationToken(s.ctx, s.installationID)
+	if err != nil {
+		return nil, fmt.Errorf("creating installation token: %v", err)
+	}
+	defer resp.Body.Close()
+	if installationToken.Token == nil || installationToken.ExpiresAt == nil {
+		return nil, fmt.Errorf("retrieved an empty installation token")
+	}
+	return &oauth2.Token{
+		AccessToken: *installationToken.Token,
+		TokenType:   "token",
+		Expiry:      *installationToken.ExpiresAt,
+	}, nil
+}
+
+// parsePrivateKey from a PEM encoded string, either PKCS1 (github default) or PKCS8.
+func parsePrivateKey(privateKeyPEM string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not a RSA key")
+	}
+	return rsaKey, nil
+}
+
+// findInstallationID of the app for the given owner, trying first as an organization then as a user.
+func (a *app) findInstallationID(ctx context.Context, owner string) (int64, error) {
+	installation, resp, err := a.client.Apps.FindOrganizationInstallation(ctx, owner)
+	if err != nil {
+		installation, resp, err = a.client.Apps.FindUserInstallation(ctx, owner)
+		if err != nil {
+			return 0, fmt.Errorf("finding installation for %s: %v", owner, err)
+		}
+	}
+	defer resp.Body.Close()
+	if installation.ID == nil {
+		return 0, fmt.Errorf("retrieved an empty installation for %s", owner)
+	}
+	return *installation.ID, nil
+}
+
+// botName of the app, as displayed by github on commits and pull requests.
+func (a *app) botName(ctx context.Context) (string, error) {
+	// the app slug is not exposed by the library: request it directly
+	req, err := a.client.NewRequest("GET", "app", nil)
+	if err != nil {
+		return "", fmt.Errorf("building app request: %v", err)
+	}
+	ghApp := struct {
+		Slug *string `json:"slug,omitempty"`
+	}{}
+	resp, err := a.client.Do(ctx, req, &ghApp)
+	if err != nil {
+		return "", fmt.Errorf("getting app: %v", err)
+	}
+	defer resp.Body.Close()
+	if ghApp.Slug == nil {
+		return "", fmt.Errorf("retrieved an empty app slug")
+	}
+	return fmt.Sprintf("%s[bot]", *ghApp.Slug), nil
+}
@@ -3,9 +3,13 @@ package github
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"gha-file-sync/internal/git"
 	"gha-file-sync/internal/log"
+	"gha-file-sync/internal/provider"
 
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/gofri/go-github-ratelimit/github_ratelimit"
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
@@ -13,13 +17,105 @@ import (
 
 type Client struct {
 	*github.Client
+
+	hostURL     string
+	tokenSource oauth2.TokenSource
+	app         *app // nil when authenticated with a personal access token
 }
 
 // NewClient for github with authentication configured.
-func NewClient(ctx context.Context, ghToken string) (*Client, error) {
+// apiURL and uploadURL target a GitHub Enterprise Server instance, leave them empty for github.com.
+func NewClient(ctx context.Context, ghToken, hostURL, apiURL, uploadURL string) (*Client, error) {
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: ghToken},
 	)
+	return newClient(ctx, ts, nil, hostURL, apiURL, uploadURL)
+}
+
+// NewAppClient for github authenticated as a github app installation.
+// Installation tokens are minted with the app private key and refreshed before they expire.
+// If installationID is 0, the installation is discovered per owner: see ForOwner.
+func NewAppClient(
+	ctx context.Context,
+	appID, installationID int64, privateKeyPEM string,
+	hostURL, apiURL, uploadURL string,
+) (*Client, error) {
+	privateKey, err := parsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	jwtTS := oauth2.ReuseTokenSource(nil, jwtTokenSource{appID: appID, privateKey: privateKey})
+	appClient, err := newClient(ctx, jwtTS, nil, hostURL, apiURL, uploadURL)
+	if err != nil {
+		return nil, err
+	}
+	a := &app{
+		id:             appID,
+		installationID: installationID,
+		client:         appClient.Client,
+		hostURL:        hostURL,
+		apiURL:         apiURL,
+		uploadURL:      uploadURL,
+		installations:  map[string]*Client{},
+	}
+	// the installation is not known yet: the client can only be used as the app
+	if installationID == 0 {
+		return &Client{Client: appClient.Client, hostURL: hostURL, tokenSource: jwtTS, app: a}, nil
+	}
+	return newInstallationClient(ctx, a, installationID)
+}
+
+// ForOwner returns a client able to act on the repositories of the given owner.
+// It is only useful for github apps without a configured installation: the installation is then discovered.
+func (c *Client) ForOwner(ctx context.Context, owner string) (provider.Provider, error) {
+	if c.app == nil || c.app.installationID != 0 {
+		return c, nil
+	}
+	key := strings.ToLower(owner)
+	if installationClient, isFound := c.app.installations[key]; isFound {
+		return installationClient, nil
+	}
+	installationID, err := c.app.findInstallationID(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	installationClient, err := newInstallationClient(ctx, c.app, installationID)
+	if err != nil {
+		return nil, err
+	}
+	c.app.installations[key] = installationClient
+	return installationClient, nil
+}
+
+// GetRepoURL to clone the repository over https.
+func (c *Client) GetRepoURL(owner, repoName string) string {
+	return GetRepoURL(c.hostURL, owner, repoName)
+}
+
+// GetSSHRepoURL to clone the repository over ssh.
+func (c *Client) GetSSHRepoURL(owner, repoName string) string {
+	return GetSSHRepoURL(c.hostURL, owner, repoName)
+}
+
+// GitAuth returns the authentication method to use for git operations over https.
+// The token is retrieved on each request so that expired installation tokens are transparently refreshed.
+func (c *Client) GitAuth() http.AuthMethod {
+	if c.app == nil {
+		return &tokenAuth{tokenSource: c.tokenSource, basicAuth: GetBasicAuth}
+	}
+	return &tokenAuth{tokenSource: c.tokenSource, basicAuth: GetInstallationBasicAuth}
+}
+
+func newInstallationClient(ctx context.Context, a *app, installationID int64) (*Client, error) {
+	ts := oauth2.ReuseTokenSourceWithExpiry(nil, installationTokenSource{
+		ctx:            ctx,
+		appClient:      a.client,
+		installationID: installationID,
+	}, tokenRefreshMargin)
+	return newClient(ctx, ts, a, a.hostURL, a.apiURL, a.uploadURL)
+}
+
+func newClient(ctx context.Context, ts oauth2.TokenSource, a *app, hostURL, apiURL, uploadURL string) (*Client, error) {
 	tc := oauth2.NewClient(ctx, ts)
 	// use a rate limiter to handle better the github api limit
 	// focuses on the secondary limit: https://github.com/google/go-github#rate-limiting
@@ -30,24 +126,55 @@ func NewClient(ctx context.Context, ghToken string) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	c := github.NewClient(rateLimiter)
-	return &Client{c}, nil
+	// github.com
+	if apiURL == "" {
+		return &Client{Client: github.NewClient(rateLimiter), hostURL: hostURL, tokenSource: ts, app: a}, nil
+	}
+	// github enterprise server
+	c, err := github.NewEnterpriseClient(apiURL, uploadURL, rateLimiter)
+	if err != nil {
+		return nil, fmt.Errorf("creating enterprise client: %v", err)
+	}
+	return &Client{Client: c, hostURL: hostURL, tokenSource: ts, app: a}, nil
 }
 
-// GetAuthenticatedUsername return the username of the current authenticated user.
-func (c Client) GetAuthenticatedUsername(ctx context.Context) (string, error) {
-	user, resp, err := c.Client.Users.Get(ctx, "") // empty string makes the library returning the authenticated user
+// GetAuthenticatedUser return the identity of the current authenticated user.
+// When authenticated as a github app, it is the app bot. Without public e-mail, the noreply address is used.
+func (c Client) GetAuthenticatedUser(ctx context.Context) (git.Identity, error) {
+	login := "" // empty string makes the library returning the authenticated user
+	if c.app != nil {
+		var err error
+		if login, err = c.app.botName(ctx); err != nil {
+			return git.Identity{}, err
+		}
+	}
+	user, resp, err := c.Client.Users.Get(ctx, login)
 	if err != nil {
-		return "", fmt.Errorf("getting user: %v", err)
+		return git.Identity{}, fmt.Errorf("getting user: %v", err)
 	}
 	defer resp.Body.Close()
 	if user == nil {
-		return "", fmt.Errorf("retrieved a nil user")
+		return git.Identity{}, fmt.Errorf("retrieved a nil user")
 	}
 	if user.Login == nil {
-		return "", fmt.Errorf("retrieved an empty login")
+		return git.Identity{}, fmt.Errorf("retrieved an empty login")
+	}
+	identity := git.Identity{Name: user.GetName(), Email: user.GetEmail()}
+	if identity.Name == "" || c.app != nil { // the bot name is the one displayed by github
+		identity.Name = *user.Login
+	}
+	if identity.Email == "" {
+		identity.Email = noreplyEmail(user.GetID(), *user.Login, c.hostURL)
+	}
+	return identity, nil
+}
+
+// noreplyEmail of a user: github.com and github enterprise server do not use the same domain.
+func noreplyEmail(id int64, login, hostURL string) string {
+	if hostURL == "github.com" {
+		return fmt.Sprintf("%d+%s@users.noreply.github.com", id, login)
 	}
-	return *user.Login, nil
+	return fmt.Sprintf("%d+%s@noreply.%s", id, login, hostURL)
 }
 
 // GetHeadBranchNameByPRNumbers for a given repository as a map. Consider only opened PRs.
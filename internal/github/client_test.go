@@ -0,0 +1,58 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNoreplyEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		hostURL string
+		want    string
+	}{
+		{name: "github.com", hostURL: "github.com", want: "42+octocat@users.noreply.github.com"},
+		{name: "enterprise server", hostURL: "github.example.com", want: "42+octocat@noreply.github.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := noreplyEmail(42, "octocat", tt.hostURL); got != tt.want {
+				t.Errorf("noreplyEmail() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForOwner(t *testing.T) {
+	lookups := map[string]int{}
+	mux := nethttp.NewServeMux()
+	mux.HandleFunc("/orgs/{owner}/installation", func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		lookups[r.PathValue("owner")]++
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	appClient := newTestClient(t, mux)
+	c := &Client{Client: appClient.Client, hostURL: "github.com", app: &app{client: appClient.Client, installations: map[string]*Client{}}}
+
+	ctx := context.Background()
+	first, err := c.ForOwner(ctx, "Org")
+	if err != nil {
+		t.Fatalf("ForOwner() error = %v", err)
+	}
+	// the owner is case insensitive
+	again, err := c.ForOwner(ctx, "org")
+	if err != nil {
+		t.Fatalf("ForOwner() error = %v", err)
+	}
+	if again != first {
+		t.Errorf("ForOwner() = %p, want the cached client %p", again, first)
+	}
+	if _, err := c.ForOwner(ctx, "other"); err != nil {
+		t.Fatalf("ForOwner() error = %v", err)
+	}
+	if want := map[string]int{"Org": 1, "other": 1}; !reflect.DeepEqual(lookups, want) {
+		t.Errorf("installation lookups = %v, want %v", lookups, want)
+	}
+}
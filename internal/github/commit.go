@@ -0,0 +1,114 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+
+	"gha-file-sync/internal/git"
+
+	"github.com/google/go-github/github"
+)
+
+// treeEntry of a tree creation request.
+// The sha is not omitted when empty: a null sha deletes the file from the base tree.
+type treeEntry struct {
+	Path string  `json:"path"`
+	Mode string  `json:"mode"`
+	Type string  `json:"type"`
+	SHA  *string `json:"sha"`
+}
+
+// CommitViaAPI the given changes with the git data api: blobs, tree, commit then ref.
+// Commits created this way without author nor committer are signed by github and displayed as verified.
+func (c Client) CommitViaAPI(
+	ctx context.Context,
+	owner, repoName, branch, parentSHA, message string,
+	author, committer *git.Identity,
+	changes []git.FileChange,
+	createBranch, force bool,
+) error {
+	// 1. upload a blob per changed file
+	entries := make([]treeEntry, 0, len(changes))
+	for _, change := range changes {
+		entry := treeEntry{Path: change.Path, Mode: change.Mode, Type: "blob"}
+		if change.Deleted {
+			entry.Mode = git.RegularMode // any file mode is accepted for a deletion
+		} else {
+			blob, _, err := c.Git.CreateBlob(ctx, owner, repoName, &github.Blob{
+				Content:  github.String(base64.StdEncoding.EncodeToString(change.Content)),
+				Encoding: github.String("base64"),
+			})
+			if err != nil {
+				return fmt.Errorf("creating blob for %s: %v", change.Path, err)
+			}
+			entry.SHA = blob.SHA
+		}
+		entries = append(entries, entry)
+	}
+
+	// 2. create the tree on top of the parent one
+	parent, _, err := c.Git.GetCommit(ctx, owner, repoName, parentSHA)
+	if err != nil {
+		return fmt.Errorf("getting parent commit: %v", err)
+	}
+	req, err := c.NewRequest(nethttp.MethodPost, fmt.Sprintf("repos/%s/%s/git/trees", owner, repoName), map[string]any{
+		"base_tree": parent.GetTree().GetSHA(),
+		"tree":      entries,
+	})
+	if err != nil {
+		return fmt.Errorf("building tree request: %v", err)
+	}
+	tree := new(github.Tree)
+	if _, err := c.Do(ctx, req, tree); err != nil {
+		return fmt.Errorf("creating tree: %v", err)
+	}
+
+	// 3. create the commit: without author, github fills it with the authenticated user and signs it
+	commit, _, err := c.Git.CreateCommit(ctx, owner, repoName, &github.Commit{
+		Message:   github.String(message),
+		Tree:      &github.Tree{SHA: tree.SHA},
+		Parents:   []github.Commit{{SHA: github.String(parentSHA)}},
+		Author:    commitAuthor(author),
+		Committer: commitAuthor(committer),
+	})
+	if err != nil {
+		return fmt.Errorf("creating commit: %v", err)
+	}
+
+	// 4. point the branch to the new commit
+	ref := &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: commit.SHA},
+	}
+	if createBranch {
+		if _, _, err := c.Git.CreateRef(ctx, owner, repoName, ref); err != nil {
+			return fmt.Errorf("creating branch: %v", err)
+		}
+		return nil
+	}
+	if _, _, err := c.Git.UpdateRef(ctx, owner, repoName, ref, force); err != nil {
+		// github rejects an update which is not a fast forward as unprocessable
+		if !force && hasStatus(err, nethttp.StatusUnprocessableEntity) {
+			return fmt.Errorf("updating branch: %w", git.ErrRemoteMoved)
+		}
+		return fmt.Errorf("updating branch: %v", err)
+	}
+	return nil
+}
+
+// commitAuthor of the api for the identity, if any.
+func commitAuthor(identity *git.Identity) *github.CommitAuthor {
+	if identity == nil {
+		return nil
+	}
+	return &github.CommitAuthor{Name: github.String(identity.Name), Email: github.String(identity.Email)}
+}
+
+// hasStatus returns true if the error is an api error response with the given status code.
+func hasStatus(err error, statusCode int) bool {
+	var errResp *github.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == statusCode
+}
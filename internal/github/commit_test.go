@@ -0,0 +1,99 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"gha-file-sync/internal/git"
+
+	"github.com/google/go-github/github"
+)
+
+// newTestClient of the api served by the handler.
+func newTestClient(t *testing.T, handler nethttp.Handler) Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	gh := github.NewClient(srv.Client())
+	gh.BaseURL, _ = url.Parse(srv.URL + "/")
+	return Client{Client: gh, hostURL: "github.com"}
+}
+
+func TestCommitViaAPI(t *testing.T) {
+	tests := []struct {
+		name         string
+		createBranch bool
+		force        bool
+		author       *git.Identity
+		refStatus    int
+		wantMethod   string
+		wantMoved    bool
+		wantErr      bool
+	}{
+		{name: "update", refStatus: nethttp.StatusOK, wantMethod: nethttp.MethodPatch},
+		{name: "overridden author", author: &git.Identity{Name: "bot", Email: "bot@example.com"}, refStatus: nethttp.StatusOK, wantMethod: nethttp.MethodPatch},
+		{name: "create", createBranch: true, refStatus: nethttp.StatusCreated, wantMethod: nethttp.MethodPost},
+		{name: "not a fast forward", refStatus: nethttp.StatusUnprocessableEntity, wantMethod: nethttp.MethodPatch, wantMoved: true, wantErr: true},
+		{name: "forced update rejected", force: true, refStatus: nethttp.StatusUnprocessableEntity, wantMethod: nethttp.MethodPatch, wantErr: true},
+		{name: "server error", refStatus: nethttp.StatusInternalServerError, wantMethod: nethttp.MethodPatch, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var refMethod string
+			var commit github.Commit
+			mux := nethttp.NewServeMux()
+			mux.HandleFunc("/repos/o/r/git/blobs", func(w nethttp.ResponseWriter, _ *nethttp.Request) {
+				fmt.Fprint(w, `{"sha":"blob"}`)
+			})
+			mux.HandleFunc("/repos/o/r/git/commits/parent", func(w nethttp.ResponseWriter, _ *nethttp.Request) {
+				fmt.Fprint(w, `{"sha":"parent","tree":{"sha":"base"}}`)
+			})
+			mux.HandleFunc("/repos/o/r/git/trees", func(w nethttp.ResponseWriter, _ *nethttp.Request) {
+				fmt.Fprint(w, `{"sha":"tree"}`)
+			})
+			mux.HandleFunc("/repos/o/r/git/commits", func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				_ = json.NewDecoder(r.Body).Decode(&commit)
+				fmt.Fprint(w, `{"sha":"commit"}`)
+			})
+			refHandler := func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				refMethod = r.Method
+				w.WriteHeader(tt.refStatus)
+				if tt.refStatus >= nethttp.StatusBadRequest {
+					fmt.Fprint(w, `{"message":"rejected"}`)
+					return
+				}
+				fmt.Fprint(w, `{"ref":"refs/heads/sync","object":{"sha":"commit"}}`)
+			}
+			mux.HandleFunc("/repos/o/r/git/refs", refHandler)
+			mux.HandleFunc("/repos/o/r/git/refs/heads/sync", refHandler)
+			c := newTestClient(t, mux)
+
+			changes := []git.FileChange{
+				{Path: "a.txt", Mode: git.RegularMode, Content: []byte("a")},
+				{Path: "b.txt", Deleted: true},
+			}
+			err := c.CommitViaAPI(context.Background(), "o", "r", "sync", "parent", "msg", tt.author, tt.author, changes, tt.createBranch, tt.force)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CommitViaAPI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if moved := errors.Is(err, git.ErrRemoteMoved); moved != tt.wantMoved {
+				t.Errorf("CommitViaAPI() error = %v, want remote moved %v", err, tt.wantMoved)
+			}
+			if tt.author == nil && (commit.Author != nil || commit.Committer != nil) {
+				t.Errorf("commit author, committer = %v, %v, want none", commit.Author, commit.Committer)
+			}
+			if tt.author != nil && (commit.GetAuthor().GetEmail() != tt.author.Email || commit.GetCommitter().GetName() != tt.author.Name) {
+				t.Errorf("commit author, committer = %v, %v, want %s", commit.Author, commit.Committer, tt.author)
+			}
+			if refMethod != tt.wantMethod {
+				t.Errorf("ref request method = %s, want %s", refMethod, tt.wantMethod)
+			}
+		})
+	}
+}
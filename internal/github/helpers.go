@@ -2,14 +2,52 @@ package github
 
 import (
 	"fmt"
+	nethttp "net/http"
+
+	"gha-file-sync/internal/log"
 
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"golang.org/x/oauth2"
 )
 
 func GetRepoURL(githubHostURL, repoOwner, repoName string) string {
 	return fmt.Sprintf("https://%s/%s/%s.git", githubHostURL, repoOwner, repoName)
 }
 
+func GetSSHRepoURL(githubHostURL, repoOwner, repoName string) string {
+	return fmt.Sprintf("git@%s:%s/%s.git", githubHostURL, repoOwner, repoName)
+}
+
 func GetBasicAuth(githubToken string) *http.BasicAuth {
 	return &http.BasicAuth{Username: githubToken, Password: "x-oauth-basic"}
 }
+
+// GetInstallationBasicAuth for a github app installation token.
+func GetInstallationBasicAuth(installationToken string) *http.BasicAuth {
+	return &http.BasicAuth{Username: "x-access-token", Password: installationToken}
+}
+
+// tokenAuth is a git http authentication method using a token source.
+// The basic auth is built on each request from the current token.
+type tokenAuth struct {
+	tokenSource oauth2.TokenSource
+	basicAuth   func(token string) *http.BasicAuth
+}
+
+func (a *tokenAuth) SetAuth(r *nethttp.Request) {
+	token, err := a.tokenSource.Token()
+	if err != nil {
+		// the request is sent without credentials: the error will be reported by the git operation
+		log.Errorf("getting token for git authentication: %v", err)
+		return
+	}
+	a.basicAuth(token.AccessToken).SetAuth(r)
+}
+
+func (a *tokenAuth) Name() string {
+	return "http-token-auth"
+}
+
+func (a *tokenAuth) String() string {
+	return fmt.Sprintf("%s - %s:%s", a.Name(), "<token>", "*******")
+}
@@ -0,0 +1,89 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+
+	"gha-file-sync/internal/provider"
+)
+
+// topicsMediaType to get the repository topics: they are only returned with their preview media type on older servers.
+const topicsMediaType = "application/vnd.github.mercy-preview+json"
+
+// repository as listed by the api: the go-github version in use misses the disabled field.
+type repository struct {
+	Name  string `json:"name"`
+	Owner struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	Topics   []string `json:"topics"`
+	Language string   `json:"language"`
+	Archived bool     `json:"archived"`
+	Fork     bool     `json:"fork"`
+	Disabled bool     `json:"disabled"`
+}
+
+func (r repository) info() provider.RepositoryInfo {
+	return provider.RepositoryInfo{
+		Owner:    r.Owner.Login,
+		Name:     r.Name,
+		Topics:   r.Topics,
+		Language: r.Language,
+		Archived: r.Archived,
+		Fork:     r.Fork,
+		Disabled: r.Disabled,
+	}
+}
+
+// GetRepositoryInfo with its topics and main language.
+func (c Client) GetRepositoryInfo(ctx context.Context, owner, repoName string) (provider.RepositoryInfo, error) {
+	req, err := c.NewRequest(nethttp.MethodGet, fmt.Sprintf("repos/%s/%s", owner, repoName), nil)
+	if err != nil {
+		return provider.RepositoryInfo{}, fmt.Errorf("building request: %v", err)
+	}
+	req.Header.Set("Accept", topicsMediaType)
+	var repo repository
+	resp, err := c.Do(ctx, req, &repo)
+	if err != nil {
+		return provider.RepositoryInfo{}, fmt.Errorf("getting repository %s/%s: %w", owner, repoName, err)
+	}
+	resp.Body.Close()
+	return repo.info(), nil
+}
+
+// ListRepositories of the organization, or of the user if there is no such organization.
+func (c Client) ListRepositories(ctx context.Context, owner string) ([]provider.RepositoryInfo, error) {
+	repos, err := c.listRepositories(ctx, fmt.Sprintf("orgs/%s/repos", owner))
+	if hasStatus(err, nethttp.StatusNotFound) {
+		repos, err = c.listRepositories(ctx, fmt.Sprintf("users/%s/repos", owner))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing repositories of %s: %w", owner, err)
+	}
+	return repos, nil
+}
+
+// listRepositories of the given endpoint, all pages.
+func (c Client) listRepositories(ctx context.Context, endpoint string) ([]provider.RepositoryInfo, error) {
+	infos := []provider.RepositoryInfo{}
+	// max page size is 100: https://docs.github.com/en/rest/repos/repos#list-organization-repositories
+	for page := 1; page != 0; {
+		req, err := c.NewRequest(nethttp.MethodGet, fmt.Sprintf("%s?per_page=100&page=%d", endpoint, page), nil)
+		if err != nil {
+			return nil, fmt.Errorf("building request: %v", err)
+		}
+		req.Header.Set("Accept", topicsMediaType)
+		repos := []repository{}
+		resp, err := c.Do(ctx, req, &repos)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		for _, r := range repos {
+			infos = append(infos, r.info())
+		}
+		page = resp.NextPage
+	}
+	return infos, nil
+}
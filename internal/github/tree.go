@@ -0,0 +1,128 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+
+	"gha-file-sync/internal/git"
+
+	"github.com/google/go-github/github"
+)
+
+// GetDefaultBranch of the repository.
+func (c Client) GetDefaultBranch(ctx context.Context, owner, repoName string) (string, error) {
+	repo, resp, err := c.Client.Repositories.Get(ctx, owner, repoName)
+	if err != nil {
+		return "", fmt.Errorf("getting repository: %v", err)
+	}
+	defer resp.Body.Close()
+	if repo.GetDefaultBranch() == "" {
+		return "", fmt.Errorf("retrieved an empty default branch")
+	}
+	return repo.GetDefaultBranch(), nil
+}
+
+// ListBranchNames of the repository, sorted by name.
+func (c Client) ListBranchNames(ctx context.Context, owner, repoName string) ([]string, error) {
+	// max page size is 100: https://docs.github.com/en/rest/branches/branches#list-branches
+	opt := &github.ListOptions{PerPage: 100}
+	branchNames := []string{}
+	for {
+		branches, resp, err := c.Client.Repositories.ListBranches(ctx, owner, repoName, opt)
+		if err != nil {
+			return nil, fmt.Errorf("listing branches: %v", err)
+		}
+		resp.Body.Close()
+		for _, b := range branches {
+			branchNames = append(branchNames, b.GetName())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	sort.Strings(branchNames)
+	return branchNames, nil
+}
+
+// GetBranchHead returns the commit hash the branch points to.
+func (c Client) GetBranchHead(ctx context.Context, owner, repoName, branch string) (string, error) {
+	ref, resp, err := c.Client.Git.GetRef(ctx, owner, repoName, "heads/"+branch)
+	if err != nil {
+		return "", fmt.Errorf("getting branch %s: %v", branch, err)
+	}
+	defer resp.Body.Close()
+	if ref.Object == nil || ref.Object.GetSHA() == "" {
+		return "", fmt.Errorf("retrieved an empty ref for branch %s", branch)
+	}
+	return ref.Object.GetSHA(), nil
+}
+
+// GetTree of the given commit: blob entries by path, recursively.
+// Trees too large to be returned at once by github are walked one level at a time.
+func (c Client) GetTree(ctx context.Context, owner, repoName, commitSHA string) (map[string]git.TreeEntry, error) {
+	commit, resp, err := c.Client.Git.GetCommit(ctx, owner, repoName, commitSHA)
+	if err != nil {
+		return nil, fmt.Errorf("getting commit: %v", err)
+	}
+	resp.Body.Close()
+	tree, resp, err := c.Client.Git.GetTree(ctx, owner, repoName, commit.GetTree().GetSHA(), true)
+	if err != nil {
+		return nil, fmt.Errorf("getting tree: %v", err)
+	}
+	resp.Body.Close()
+	entries := make(map[string]git.TreeEntry, len(tree.Entries))
+	if tree.GetTruncated() {
+		if err := c.walkTree(ctx, owner, repoName, commit.GetTree().GetSHA(), "", entries); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+	for _, e := range tree.Entries {
+		if e.GetType() != "blob" {
+			continue
+		}
+		entries[e.GetPath()] = git.TreeEntry{Hash: e.GetSHA(), Mode: e.GetMode()}
+	}
+	return entries, nil
+}
+
+// walkTree non recursively, adding its blob entries to the given ones, then walking its subtrees.
+func (c Client) walkTree(
+	ctx context.Context,
+	owner, repoName, treeSHA, dirPath string,
+	entries map[string]git.TreeEntry,
+) error {
+	tree, resp, err := c.Client.Git.GetTree(ctx, owner, repoName, treeSHA, false)
+	if err != nil {
+		return fmt.Errorf("getting tree %s: %v", dirPath, err)
+	}
+	resp.Body.Close()
+	if tree.GetTruncated() {
+		return fmt.Errorf("tree %s is too large to be retrieved through the api", dirPath)
+	}
+	for _, e := range tree.Entries {
+		entryPath := path.Join(dirPath, e.GetPath())
+		switch e.GetType() {
+		case "blob":
+			entries[entryPath] = git.TreeEntry{Hash: e.GetSHA(), Mode: e.GetMode()}
+		case "tree":
+			if err := c.walkTree(ctx, owner, repoName, e.GetSHA(), entryPath, entries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetBlob content by hash.
+func (c Client) GetBlob(ctx context.Context, owner, repoName, sha string) ([]byte, error) {
+	content, resp, err := c.Client.Git.GetBlobRaw(ctx, owner, repoName, sha)
+	if err != nil {
+		return nil, fmt.Errorf("getting blob %s: %v", sha, err)
+	}
+	defer resp.Body.Close()
+	return content, nil
+}
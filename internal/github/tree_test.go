@@ -0,0 +1,87 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+	"reflect"
+	"testing"
+
+	"gha-file-sync/internal/git"
+)
+
+func TestGetTree(t *testing.T) {
+	tests := []struct {
+		name      string
+		truncated bool
+		subTrees  map[string]string // non recursive trees by sha
+		want      map[string]git.TreeEntry
+		wantErr   bool
+	}{
+		{
+			name: "recursive",
+			want: map[string]git.TreeEntry{
+				"README.md":   {Hash: "readme", Mode: "100644"},
+				"dir/run.sh":  {Hash: "run", Mode: "100755"},
+				"dir/sub/a.c": {Hash: "a", Mode: "100644"},
+			},
+		},
+		{
+			name:      "truncated",
+			truncated: true,
+			subTrees: map[string]string{
+				"root": `{"sha":"root","tree":[{"path":"README.md","type":"blob","sha":"readme","mode":"100644"},{"path":"dir","type":"tree","sha":"dir"}]}`,
+				"dir":  `{"sha":"dir","tree":[{"path":"run.sh","type":"blob","sha":"run","mode":"100755"},{"path":"sub","type":"tree","sha":"sub"},{"path":"mod","type":"commit","sha":"mod"}]}`,
+				"sub":  `{"sha":"sub","tree":[{"path":"a.c","type":"blob","sha":"a","mode":"100644"}]}`,
+			},
+			want: map[string]git.TreeEntry{
+				"README.md":   {Hash: "readme", Mode: "100644"},
+				"dir/run.sh":  {Hash: "run", Mode: "100755"},
+				"dir/sub/a.c": {Hash: "a", Mode: "100644"},
+			},
+		},
+		{
+			name:      "truncated subtree",
+			truncated: true,
+			subTrees: map[string]string{
+				"root": `{"sha":"root","tree":[{"path":"dir","type":"tree","sha":"dir"}]}`,
+				"dir":  `{"sha":"dir","tree":[],"truncated":true}`,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := nethttp.NewServeMux()
+			mux.HandleFunc("/repos/o/r/git/commits/head", func(w nethttp.ResponseWriter, _ *nethttp.Request) {
+				fmt.Fprint(w, `{"sha":"head","tree":{"sha":"root"}}`)
+			})
+			mux.HandleFunc("/repos/o/r/git/trees/", func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				sha := r.URL.Path[len("/repos/o/r/git/trees/"):]
+				if r.URL.Query().Get("recursive") == "" {
+					fmt.Fprint(w, tt.subTrees[sha])
+					return
+				}
+				if tt.truncated {
+					fmt.Fprint(w, `{"sha":"root","tree":[{"path":"README.md","type":"blob","sha":"readme","mode":"100644"}],"truncated":true}`)
+					return
+				}
+				fmt.Fprint(w, `{"sha":"root","tree":[`+
+					`{"path":"README.md","type":"blob","sha":"readme","mode":"100644"},`+
+					`{"path":"dir","type":"tree","sha":"dir"},`+
+					`{"path":"dir/run.sh","type":"blob","sha":"run","mode":"100755"},`+
+					`{"path":"dir/sub","type":"tree","sha":"sub"},`+
+					`{"path":"dir/sub/a.c","type":"blob","sha":"a","mode":"100644"}]}`)
+			})
+			c := newTestClient(t, mux)
+
+			got, err := c.GetTree(context.Background(), "o", "r", "head")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetTree() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTree() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+
+	"gha-file-sync/internal/git"
+	"gha-file-sync/internal/log"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+type Client struct {
+	*gitlab.Client
+
+	hostURL string
+	token   string
+}
+
+// NewClient for gitlab with authentication configured.
+// The API is expected at https://{hostURL}/api/v4/.
+func NewClient(glToken, hostURL string) (*Client, error) {
+	c, err := gitlab.NewClient(glToken, gitlab.WithBaseURL(fmt.Sprintf("https://%s/api/v4/", hostURL)))
+	if err != nil {
+		return nil, fmt.Errorf("creating gitlab client: %v", err)
+	}
+	return &Client{Client: c, hostURL: hostURL, token: glToken}, nil
+}
+
+// GetAuthenticatedUser return the identity of the current authenticated user.
+// The e-mail is the public one if set, the primary one otherwise, then the private commit e-mail of the user.
+func (c Client) GetAuthenticatedUser(ctx context.Context) (git.Identity, error) {
+	user, _, err := c.Client.Users.CurrentUser(gitlab.WithContext(ctx))
+	if err != nil {
+		return git.Identity{}, fmt.Errorf("getting user: %v", err)
+	}
+	if user == nil || user.Username == "" {
+		return git.Identity{}, fmt.Errorf("retrieved an empty user")
+	}
+	identity := git.Identity{Name: user.Name, Email: user.PublicEmail}
+	if identity.Name == "" {
+		identity.Name = user.Username
+	}
+	if identity.Email == "" {
+		identity.Email = user.Email
+	}
+	if identity.Email == "" {
+		identity.Email = fmt.Sprintf("%d-%s@users.noreply.%s", user.ID, user.Username, c.hostURL)
+	}
+	return identity, nil
+}
+
+// GetHeadBranchNameByPRNumbers for a given project as a map of merge request IIDs. Consider only opened MRs.
+// The owner is the namespace of the project, which can contain subgroups.
+func (c Client) GetHeadBranchNameByPRNumbers(ctx context.Context, owner, repoName string) (map[int]string, error) {
+	// max page size is 100: https://docs.gitlab.com/ee/api/rest/index.html#pagination
+	opt := &gitlab.ListProjectMergeRequestsOptions{
+		State:       gitlab.Ptr("opened"),
+		ListOptions: gitlab.ListOptions{PerPage: 99},
+	}
+	mrs, _, err := c.Client.MergeRequests.ListProjectMergeRequests(projectID(owner, repoName), opt, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("listing mrs: %v", err)
+	}
+
+	// log a warning if the number of MR retrieved is the maximum page size
+	if len(mrs) == 99 { //nolint:gomnd
+		log.Warnf("99 opened MRs on this project, this may make the synchronization to fail")
+	}
+
+	headBranchNameByMRIIDs := make(map[int]string, len(mrs))
+	for _, mr := range mrs {
+		headBranchNameByMRIIDs[mr.IID] = mr.SourceBranch
+	}
+	return headBranchNameByMRIIDs, nil
+}
+
+// CreateOrUpdatePR according to the existingPRNumber parameter, which is a merge request IID.
+// On update, the desc is added to the Merge Request as a note.
+func (c Client) CreateOrUpdatePR(
+	ctx context.Context, existingPRNumber *int,
+	owner, repoName,
+	baseBranch, headBranch,
+	title, desc string,
+) error {
+	pid := projectID(owner, repoName)
+	if existingPRNumber == nil { // create mode
+		mr := &gitlab.CreateMergeRequestOptions{
+			Title:              &title,
+			Description:        &desc,
+			SourceBranch:       &headBranch,
+			TargetBranch:       &baseBranch,
+			AllowCollaboration: gitlab.Ptr(true),
+		}
+		createdMR, _, err := c.Client.MergeRequests.CreateMergeRequest(pid, mr, gitlab.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("creating MR: %v", err)
+		}
+		log.Infof("MR created: %s", createdMR.WebURL)
+	} else { // update mode = create a note with the given desc
+		desc = fmt.Sprintf("MR updated with additional changes: %s", desc)
+		_, _, err := c.Client.Notes.CreateMergeRequestNote(pid, *existingPRNumber, &gitlab.CreateMergeRequestNoteOptions{
+			Body: &desc,
+		}, gitlab.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("creating note on MR: %v", err)
+		}
+		log.Infof("MR updated: !%d", *existingPRNumber)
+	}
+	return nil
+}
+
+// GetRepoURL to clone the project over https.
+func (c Client) GetRepoURL(owner, repoName string) string {
+	return fmt.Sprintf("https://%s/%s/%s.git", c.hostURL, owner, repoName)
+}
+
+// GetSSHRepoURL to clone the project over ssh.
+func (c Client) GetSSHRepoURL(owner, repoName string) string {
+	return fmt.Sprintf("git@%s:%s/%s.git", c.hostURL, owner, repoName)
+}
+
+// GitAuth returns the authentication method to use for git operations over https.
+func (c Client) GitAuth() http.AuthMethod {
+	// any non-empty username is accepted with a personal, project or group access token
+	return &http.BasicAuth{Username: "oauth2", Password: c.token}
+}
+
+// projectID as expected by the API: the full path of the project.
+func projectID(owner, repoName string) string {
+	return fmt.Sprintf("%s/%s", owner, repoName)
+}
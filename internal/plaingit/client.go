@@ -0,0 +1,68 @@
+package plaingit
+
+import (
+	"context"
+	"fmt"
+
+	"gha-file-sync/internal/git"
+	"gha-file-sync/internal/provider"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// Client for a git host without any usable API: bare mirrors, hosts without API token...
+// It only provides what is needed to clone and push, change requests are not supported.
+type Client struct {
+	hostURL    string
+	username   string
+	password   string
+	authorName string
+}
+
+// NewClient for a plain git host. Credentials are optional: no authentication is used if the username is empty.
+func NewClient(hostURL, username, password, authorName string) *Client {
+	return &Client{
+		hostURL:    hostURL,
+		username:   username,
+		password:   password,
+		authorName: authorName,
+	}
+}
+
+// GetAuthenticatedUser returns the configured author name without e-mail: there is no user to retrieve.
+func (c Client) GetAuthenticatedUser(ctx context.Context) (git.Identity, error) {
+	return git.Identity{Name: c.authorName}, nil
+}
+
+// GetHeadBranchNameByPRNumbers is not supported: there is no change request on a plain git host.
+func (c Client) GetHeadBranchNameByPRNumbers(ctx context.Context, owner, repoName string) (map[int]string, error) {
+	return nil, fmt.Errorf("listing prs: %w", provider.ErrNotSupported)
+}
+
+// CreateOrUpdatePR is not supported: there is no change request on a plain git host.
+func (c Client) CreateOrUpdatePR(
+	ctx context.Context, existingPRNumber *int,
+	owner, repoName,
+	baseBranch, headBranch,
+	title, desc string,
+) error {
+	return fmt.Errorf("creating or updating PR: %w", provider.ErrNotSupported)
+}
+
+// GetRepoURL to clone the repository over https.
+func (c Client) GetRepoURL(owner, repoName string) string {
+	return fmt.Sprintf("https://%s/%s/%s.git", c.hostURL, owner, repoName)
+}
+
+// GetSSHRepoURL to clone the repository over ssh.
+func (c Client) GetSSHRepoURL(owner, repoName string) string {
+	return fmt.Sprintf("git@%s:%s/%s.git", c.hostURL, owner, repoName)
+}
+
+// GitAuth returns the authentication method to use for git operations over https.
+func (c Client) GitAuth() http.AuthMethod {
+	if c.username == "" {
+		return nil
+	}
+	return &http.BasicAuth{Username: c.username, Password: c.password}
+}
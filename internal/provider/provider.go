@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gha-file-sync/internal/git"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// Kind of git hosting service.
+type Kind string
+
+const (
+	GitHub    Kind = "github"
+	GitLab    Kind = "gitlab"
+	Gitea     Kind = "gitea" // also compatible with forgejo
+	Bitbucket Kind = "bitbucket"
+	Azure     Kind = "azure" // azure devops repos
+	Git       Kind = "git"   // plain git host without api: only push modes are supported
+)
+
+// Kinds lists all supported providers.
+var Kinds = []Kind{GitHub, GitLab, Gitea, Bitbucket, Azure, Git}
+
+// ErrNotSupported is returned by providers for operations they cannot perform.
+var ErrNotSupported = errors.New("not supported by the provider")
+
+// Provider is a git hosting service on which repositories are synchronized through change requests:
+// pull requests, merge requests...
+type Provider interface {
+	// GetAuthenticatedUser return the identity of the current authenticated user, used as commit author.
+	// The e-mail is empty if the provider doesn't expose it.
+	GetAuthenticatedUser(ctx context.Context) (git.Identity, error)
+	// GetHeadBranchNameByPRNumbers for a given repository as a map. Consider only opened change requests.
+	GetHeadBranchNameByPRNumbers(ctx context.Context, owner, repoName string) (map[int]string, error)
+	// CreateOrUpdatePR according to the existingPRNumber parameter.
+	// On update, the desc is added to the change request as a comment.
+	CreateOrUpdatePR(
+		ctx context.Context, existingPRNumber *int,
+		owner, repoName,
+		baseBranch, headBranch,
+		title, desc string,
+	) error
+	// GetRepoURL to clone the repository over https.
+	GetRepoURL(owner, repoName string) string
+	// GetSSHRepoURL to clone the repository over ssh.
+	GetSSHRepoURL(owner, repoName string) string
+	// GitAuth returns the authentication method to use for git operations over https.
+	GitAuth() http.AuthMethod
+}
+
+// OwnerScoper is implemented by providers whose credentials depend on the owner of the repository.
+type OwnerScoper interface {
+	// ForOwner returns a provider able to act on the repositories of the given owner.
+	ForOwner(ctx context.Context, owner string) (Provider, error)
+}
+
+// APICommitter is implemented by providers able to create commits through their api.
+// Such commits are signed by the provider itself.
+type APICommitter interface {
+	// CommitViaAPI the given changes on top of the parent commit then points the branch to it.
+	// The branch is created if createBranch is true. Without force, git.ErrRemoteMoved is returned
+	// if the branch is not on the parent commit anymore.
+	// Without author and committer, the commit is authored by the authenticated user.
+	CommitViaAPI(
+		ctx context.Context,
+		owner, repoName, branch, parentSHA, message string,
+		author, committer *git.Identity,
+		changes []git.FileChange,
+		createBranch, force bool,
+	) error
+}
+
+// RemoteReader is implemented by providers able to read repositories through their api, without cloning them.
+type RemoteReader interface {
+	// GetDefaultBranch of the repository.
+	GetDefaultBranch(ctx context.Context, owner, repoName string) (string, error)
+	// ListBranchNames of the repository, sorted by name.
+	ListBranchNames(ctx context.Context, owner, repoName string) ([]string, error)
+	// GetBranchHead returns the commit hash the branch points to.
+	GetBranchHead(ctx context.Context, owner, repoName, branch string) (string, error)
+	// GetTree of the given commit: file entries by path, recursively.
+	GetTree(ctx context.Context, owner, repoName, commitSHA string) (map[string]git.TreeEntry, error)
+	// GetBlob content by hash.
+	GetBlob(ctx context.Context, owner, repoName, sha string) ([]byte, error)
+}
+
+// RepositoryInfo of a repository listed through a provider api.
+type RepositoryInfo struct {
+	Owner    string
+	Name     string
+	Topics   []string
+	Language string
+	Archived bool
+	Fork     bool
+	Disabled bool
+}
+
+// RepositoryLister is implemented by providers able to list repositories through their api.
+type RepositoryLister interface {
+	// ListRepositories of the organization or user.
+	ListRepositories(ctx context.Context, owner string) ([]RepositoryInfo, error)
+}
+
+// RepositoryInfoReader is implemented by providers able to describe a repository through their api.
+type RepositoryInfoReader interface {
+	// GetRepositoryInfo of the repository.
+	GetRepositoryInfo(ctx context.Context, owner, repoName string) (RepositoryInfo, error)
+}
+
+// Registry of the configured providers.
+type Registry map[Kind]Provider
+
+// Get the provider to use for a repository of the given owner.
+func (r Registry) Get(ctx context.Context, kind Kind, owner string) (Provider, error) {
+	p, ok := r[kind]
+	if !ok {
+		return nil, fmt.Errorf("provider %s is not configured", kind)
+	}
+	if scoper, ok := p.(OwnerScoper); ok {
+		return scoper.ForOwner(ctx, owner)
+	}
+	return p, nil
+}
+
+// ParseKind returns the kind matching the given string or an error if not supported.
+func ParseKind(s string) (Kind, error) {
+	for _, k := range Kinds {
+		if string(k) == s {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown provider %s", s)
+}
@@ -0,0 +1,367 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/git"
+	"gha-file-sync/internal/log"
+	"gha-file-sync/internal/provider"
+)
+
+// APITask synchronizes a repository through the provider api, without cloning it:
+// bound files are compared by blob hash with the remote tree and changes are committed through the api.
+type APITask struct {
+	// repo config
+	repoName string
+	owner    string
+
+	// local source config
+	sourcePath string
+	source     actionSource
+
+	// provider config
+	provider  provider.Provider
+	reader    provider.RemoteReader
+	committer provider.APICommitter
+
+	// additional config
+	fileSyncBranchRegexp *regexp.Regexp
+	fileBindings         []cfg.FileBinding
+	targetOptIn          bool
+	syncMode             string
+	pushBranch           string
+	commitTrailers       []string
+	trailerAuthor        git.Identity
+	signOff              bool
+	coAuthors            []git.Identity
+	// apiAuthor and apiCommitter of the commits: only set if overridden
+	apiAuthor, apiCommitter *git.Identity
+
+	// internal state
+	baseBranchName   string
+	syncBranchName   string
+	parentSHA        string // commit the sync branch points to, or will be created from
+	isNewBranch      bool
+	existingPRNumber *int
+	changes          []git.FileChange
+	lfsObjects       []git.LFSObject
+	lfsEndpoint      string
+	pinned           pinnedSource
+	baseTree         map[string]git.TreeEntry // tree of the base branch, read with the target config
+	patchReports     []string
+}
+
+// NewAPITask configured with default values and given parameters.
+// The provider must be able to read repositories and commit through its api.
+func NewAPITask(
+	ctx context.Context,
+	owner, repoName string,
+	source actionSource,
+	p provider.Provider,
+	fileSyncBranchRegexpStr string,
+	fileBindings []cfg.FileBinding, targetOptIn bool,
+	syncMode, pushBranch string,
+	authorOverride, committerOverride git.Identity,
+	signOff bool, coAuthors []git.Identity,
+) (t APITask, err error) {
+	reader, isReader := p.(provider.RemoteReader)
+	committer, isCommitter := p.(provider.APICommitter)
+	if !isReader || !isCommitter {
+		return t, fmt.Errorf("syncing through the api: %w", provider.ErrNotSupported)
+	}
+	t = APITask{
+		repoName: repoName,
+		owner:    owner,
+
+		sourcePath: source.path,
+		source:     source,
+
+		provider:  p,
+		reader:    reader,
+		committer: committer,
+
+		fileSyncBranchRegexp: regexp.MustCompile(fileSyncBranchRegexpStr),
+		fileBindings:         fileBindings,
+		targetOptIn:          targetOptIn,
+		syncMode:             syncMode,
+		pushBranch:           pushBranch,
+
+		syncBranchName: defaultSyncBranchName(),
+	}
+
+	// the commit is authored by the authenticated user unless overridden: the configured identity prevails
+	author, err := p.GetAuthenticatedUser(ctx)
+	if err != nil {
+		return t, err
+	}
+	author = author.Override(authorOverride)
+	// the trailers are computed once the target config is read: a pinned source has its own co-authors
+	t.trailerAuthor, t.signOff, t.coAuthors = author, signOff, coAuthors
+	t.apiAuthor, t.apiCommitter = apiIdentities(author, author.Override(committerOverride), authorOverride, committerOverride)
+	return t, nil
+}
+
+// PickSyncBranch on the repo which will be used to compare files and commit potential changes,
+// following the same rules as Task.PickSyncBranch, then resolves the commit to compare with.
+func (t *APITask) PickSyncBranch(ctx context.Context) error {
+	var err error
+	if t.baseBranchName, err = t.reader.GetDefaultBranch(ctx, t.owner, t.repoName); err != nil {
+		return err
+	}
+
+	switch t.syncMode {
+	case cfg.SyncModeDirect:
+		t.syncBranchName = t.baseBranchName
+	case cfg.SyncModePush:
+		branchNames, err := t.reader.ListBranchNames(ctx, t.owner, t.repoName)
+		if err != nil {
+			return fmt.Errorf("getting branches: %v", err)
+		}
+		var branchName string
+		branchName, t.isNewBranch = findRemoteSyncBranch(branchNames, t.pushBranch, t.fileSyncBranchRegexp, t.repoName)
+		if branchName != "" {
+			t.syncBranchName = branchName
+		}
+	default:
+		branchName, prNumber, err := findPRSyncBranch(ctx, t.provider, t.owner, t.repoName, t.fileSyncBranchRegexp)
+		if err != nil {
+			return err
+		}
+		if prNumber != nil {
+			t.syncBranchName = branchName
+			t.existingPRNumber = prNumber
+		}
+		t.isNewBranch = (prNumber == nil)
+	}
+
+	// a new branch is created from the base branch
+	parentBranchName := t.syncBranchName
+	if t.isNewBranch {
+		parentBranchName = t.baseBranchName
+	}
+	if t.parentSHA, err = t.reader.GetBranchHead(ctx, t.owner, t.repoName, parentBranchName); err != nil {
+		return err
+	}
+	return t.readTargetConfig(ctx, parentBranchName)
+}
+
+// readTargetConfig from the base branch and apply it to the bindings.
+func (t *APITask) readTargetConfig(ctx context.Context, parentBranchName string) error {
+	var err error
+	baseSHA := t.parentSHA
+	if parentBranchName != t.baseBranchName {
+		if baseSHA, err = t.reader.GetBranchHead(ctx, t.owner, t.repoName, t.baseBranchName); err != nil {
+			return err
+		}
+	}
+	if t.baseTree, err = t.reader.GetTree(ctx, t.owner, t.repoName, baseSHA); err != nil {
+		return err
+	}
+	var content []byte
+	entry, exists := t.baseTree[TargetConfigPath]
+	if exists {
+		if content, err = t.reader.GetBlob(ctx, t.owner, t.repoName, entry.Hash); err != nil {
+			return err
+		}
+	}
+	if t.fileBindings, t.pinned, err = applyTargetConfig(content, exists, t.targetOptIn, t.fileBindings, t.source); err != nil {
+		return err
+	}
+	t.commitTrailers = commitTrailers(t.trailerAuthor, t.signOff, t.pinned.coAuthors(t.source, t.fileBindings, t.coAuthors))
+	return nil
+}
+
+// HasChangedAfterCopy compares the bound source files with the remote tree of the sync branch,
+// keeping the files to commit, and returns true if something has changed.
+func (t *APITask) HasChangedAfterCopy(ctx context.Context) (bool, error) {
+	// return directly if no files bindings defined
+	if len(t.fileBindings) == 0 {
+		return false, nil
+	}
+
+	tree, err := t.reader.GetTree(ctx, t.owner, t.repoName, t.parentSHA)
+	if err != nil {
+		return false, err
+	}
+
+	// the conditions are evaluated on the base branch, as the target config
+	filePaths := make([]string, 0, len(t.baseTree))
+	for filePath := range t.baseTree {
+		filePaths = append(filePaths, filePath)
+	}
+	bindings := applicableBindings(t.fileBindings, newTargetRepo(ctx, t.provider, t.owner, t.repoName, filePaths))
+	if len(bindings) == 0 {
+		return false, nil
+	}
+
+	attrs, err := t.readAttributes(ctx, tree)
+	if err != nil {
+		return false, err
+	}
+	tgt := newTarget(attrs, func(filePath string) ([]byte, bool, error) {
+		entry, exists := tree[filePath]
+		if !exists {
+			return nil, false, nil
+		}
+		content, err := t.reader.GetBlob(ctx, t.owner, t.repoName, entry.Hash)
+		return content, true, err
+	}, sourceHistory(t.sourcePath))
+
+	notAnyCopySuccess := true
+	for _, b := range bindings {
+		changes, err := readBinding(t.sourcePath, b, tgt)
+		if err != nil {
+			log.Errorf("reading %s: %v", b.Source, err)
+			continue
+		}
+		for _, change := range changes {
+			entry, exists := tree[change.Path]
+			// a patched file keeps its mode
+			if exists && b.Patch != "" && b.Mode == "" {
+				change.Mode = entry.Mode
+			}
+			if !exists || entry.Hash != change.Hash() || entry.Mode != change.Mode {
+				t.changes = append(t.changes, change)
+			}
+		}
+		notAnyCopySuccess = false
+	}
+	if notAnyCopySuccess {
+		return false, fmt.Errorf("not able to copy any file")
+	}
+	t.lfsObjects = tgt.sortedLFSObjects()
+	t.patchReports = tgt.sortedPatchReports()
+	if len(t.lfsObjects) > 0 {
+		if t.lfsEndpoint, err = tgt.lfsEndpoint(t.provider.GetRepoURL(t.owner, t.repoName)); err != nil {
+			return false, err
+		}
+	}
+	return len(t.changes) > 0, nil
+}
+
+// UpdateRemote by committing the changes through the api then opening or updating the PR.
+func (t *APITask) UpdateRemote(ctx context.Context, commitMsg, prTitle string) error {
+	// never force the base branch nor a fixed push branch update: it fails if the branch has moved since the comparison
+	isDirect := (t.syncMode == cfg.SyncModeDirect)
+	// the committed pointers must reference existing objects
+	if err := uploadLFSObjects(ctx, t.provider, t.owner, t.repoName, t.lfsEndpoint, t.lfsObjects); err != nil {
+		return err
+	}
+	commitMsg = withPatchReports(t.pinned.withSource(commitMsg), t.patchReports)
+	if err := t.committer.CommitViaAPI(
+		ctx,
+		t.owner, t.repoName, t.syncBranchName, t.parentSHA, withTrailers(commitMsg, t.commitTrailers),
+		t.apiAuthor, t.apiCommitter,
+		t.changes,
+		t.isNewBranch, isForcePushed(t.syncMode, t.pushBranch),
+	); err != nil {
+		return err
+	}
+	// push and direct modes: the branch is the only expected result
+	if t.syncMode == cfg.SyncModePush || isDirect {
+		log.Infof("branch pushed: %s", t.syncBranchName)
+		return nil
+	}
+	return t.provider.CreateOrUpdatePR(
+		ctx, t.existingPRNumber,
+		t.owner, t.repoName,
+		t.baseBranchName, t.syncBranchName,
+		prTitle, commitMsg,
+	)
+}
+
+// readAttributes of the remote tree, from its .gitattributes files.
+func (t *APITask) readAttributes(ctx context.Context, tree map[string]git.TreeEntry) (git.Attributes, error) {
+	files := map[string][]byte{}
+	for filePath, entry := range tree {
+		if path.Base(filePath) != git.AttributesFileName {
+			continue
+		}
+		content, err := t.reader.GetBlob(ctx, t.owner, t.repoName, entry.Hash)
+		if err != nil {
+			return git.Attributes{}, err
+		}
+		files[filePath] = content
+	}
+	return git.ReadAttributes(files)
+}
+
+// CleanAll removes the pinned source, if any: nothing else is written locally.
+func (t *APITask) CleanAll(ctx context.Context) error {
+	return t.pinned.clean()
+}
+
+// cleanDest returns the destination path relative to the repository root, empty for the root itself.
+func cleanDest(dest string) string {
+	return strings.TrimPrefix(path.Clean("/"+dest), "/")
+}
+
+// readBinding returns the files of its source, a file or a directory, as changes at their destination path,
+// with the file mode forced if any and contents as the target stores them, except the files kept by the write policy.
+func readBinding(sourcePath string, b cfg.FileBinding, tgt target) ([]git.FileChange, error) {
+	src := b.SourcePath(sourcePath)
+	dest := cleanDest(b.Dest)
+	changes := []git.FileChange{}
+	found := false // kept files are not changes
+	err := filepath.WalkDir(src, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		found = true
+		relPath, err := filepath.Rel(src, filePath)
+		if err != nil {
+			return err
+		}
+		destPath := path.Join(dest, filepath.ToSlash(relPath))
+		sourceFile := path.Join(filepath.ToSlash(b.Source), filepath.ToSlash(relPath))
+		keep, err := tgt.keeps(destPath, sourceFile, b)
+		if err != nil {
+			return err
+		}
+		if keep {
+			log.Infof("-> %s kept: write %s", destPath, b.Write)
+			return nil
+		}
+		change, err := git.ReadFileChange(filePath, destPath)
+		if err != nil {
+			return err
+		}
+		if !change.IsSymlink() {
+			if b.Patch != "" {
+				content, write, err := tgt.patched(change.Path, sourceFile, change.Content, b)
+				if err != nil || !write {
+					return err
+				}
+				change.Content = content
+			} else if change.Content, err = tgt.content(change.Path, filePath, change.Content, b); err != nil {
+				return err
+			}
+			switch b.Mode {
+			case cfg.FileModeExecutable:
+				change.Mode = git.ExecutableMode
+			case cfg.FileModeRegular:
+				change.Mode = git.RegularMode
+			}
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 && !found {
+		return nil, fmt.Errorf("no file found: %w", os.ErrNotExist)
+	}
+	return changes, nil
+}
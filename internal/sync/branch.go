@@ -0,0 +1,90 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/log"
+	"gha-file-sync/internal/provider"
+)
+
+// defaultSyncBranchName of a new sync branch.
+func defaultSyncBranchName() string {
+	return fmt.Sprintf("%s-sync-file-pr", time.Now().Format("2006-01-02"))
+}
+
+// findPRSyncBranch by checking opened PRs: the sync branch is the head branch of an existing file sync PR.
+// The PR number is nil if none was found.
+func findPRSyncBranch(
+	ctx context.Context, p provider.Provider,
+	owner, repoName string,
+	fileSyncBranchRegexp *regexp.Regexp,
+) (branchName string, prNumber *int, err error) {
+	// try to find an existing file sync branch by checking opened PRs
+	branchNameByPRNumbers, err := p.GetHeadBranchNameByPRNumbers(ctx, owner, repoName)
+	if err != nil {
+		return "", nil, fmt.Errorf("getting branches: %v", err)
+	}
+
+	// try to find an existing file sync PR
+	for number, name := range branchNameByPRNumbers {
+		// use branch name to see if it is an file sync PR
+		// skip it if it doesn't match
+		if !fileSyncBranchRegexp.MatchString(name) {
+			continue
+		}
+
+		// if any sync PR was already found, raise a warning about it, keep the first one found by breaking the loop
+		if prNumber != nil {
+			log.Warnf("it seems there are two existing file sync pull requests on repo %s", repoName)
+			break
+		}
+		// set the existing sync branch and existing PR
+		branchName = name
+		prNumber = new(int)
+		*prNumber = number
+	}
+	return branchName, prNumber, nil
+}
+
+// isForcePushed sync branch: only the branches owned by the action are rewritten,
+// never the base branch nor a fixed push branch which others may push to.
+func isForcePushed(syncMode, pushBranch string) bool {
+	return syncMode != cfg.SyncModeDirect && (syncMode != cfg.SyncModePush || pushBranch == "")
+}
+
+// isRetried sync when the remote branch has moved: the update of a branch not owned by the action is not forced.
+func isRetried(syncMode, pushBranch string) bool {
+	return syncMode == cfg.SyncModeDirect || (syncMode == cfg.SyncModePush && pushBranch != "")
+}
+
+// findRemoteSyncBranch among the given remote branches, without relying on any hosting api.
+// The sync branch is the configured push branch if any, otherwise the first branch matching the file sync regexp.
+// The branch name is empty if a new branch with the default name should be created.
+func findRemoteSyncBranch(
+	branchNames []string, pushBranch string,
+	fileSyncBranchRegexp *regexp.Regexp, repoName string,
+) (branchName string, isNewBranch bool) {
+	// a fixed branch is configured: create it only if it doesn't exist yet
+	if pushBranch != "" {
+		return pushBranch, !slices.Contains(branchNames, pushBranch)
+	}
+
+	// try to find an existing file sync branch
+	for _, name := range branchNames {
+		if !fileSyncBranchRegexp.MatchString(name) {
+			continue
+		}
+		// if any sync branch was already found, raise a warning about it, keep the first one found by breaking the loop
+		if branchName != "" {
+			log.Warnf("it seems there are two existing file sync branches on repo %s", repoName)
+			break
+		}
+		branchName = name
+	}
+	return branchName, (branchName == "")
+}
@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"regexp"
+	"testing"
+
+	"gha-file-sync/internal/cfg"
+)
+
+func TestIsForcePushed(t *testing.T) {
+	tests := []struct {
+		name        string
+		syncMode    string
+		pushBranch  string
+		wantForce   bool
+		wantRetried bool
+	}{
+		{name: "pull request", syncMode: cfg.SyncModePullRequest, wantForce: true},
+		{name: "push to a sync branch", syncMode: cfg.SyncModePush, wantForce: true},
+		{name: "push to a fixed branch", syncMode: cfg.SyncModePush, pushBranch: "sync", wantRetried: true},
+		{name: "direct", syncMode: cfg.SyncModeDirect, wantRetried: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isForcePushed(tt.syncMode, tt.pushBranch); got != tt.wantForce {
+				t.Errorf("isForcePushed() = %v, want %v", got, tt.wantForce)
+			}
+			if got := isRetried(tt.syncMode, tt.pushBranch); got != tt.wantRetried {
+				t.Errorf("isRetried() = %v, want %v", got, tt.wantRetried)
+			}
+		})
+	}
+}
+
+func TestFindRemoteSyncBranch(t *testing.T) {
+	syncRegexp := regexp.MustCompile(`^file-sync-\d+$`)
+	tests := []struct {
+		name          string
+		branchNames   []string
+		pushBranch    string
+		wantBranch    string
+		wantNewBranch bool
+	}{
+		{name: "existing push branch", branchNames: []string{"main", "sync"}, pushBranch: "sync", wantBranch: "sync"},
+		{name: "missing push branch", branchNames: []string{"main"}, pushBranch: "sync", wantBranch: "sync", wantNewBranch: true},
+		{name: "existing sync branch", branchNames: []string{"main", "file-sync-1"}, wantBranch: "file-sync-1"},
+		{name: "first of several sync branches", branchNames: []string{"file-sync-1", "file-sync-2"}, wantBranch: "file-sync-1"},
+		{name: "no sync branch", branchNames: []string{"main", "file-sync"}, wantNewBranch: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			branchName, isNewBranch := findRemoteSyncBranch(tt.branchNames, tt.pushBranch, syncRegexp, "repo")
+			if branchName != tt.wantBranch || isNewBranch != tt.wantNewBranch {
+				t.Errorf("findRemoteSyncBranch() = %s, %v, want %s, %v", branchName, isNewBranch, tt.wantBranch, tt.wantNewBranch)
+			}
+		})
+	}
+}
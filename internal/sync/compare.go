@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gha-file-sync/internal/cfg"
+
+	"gopkg.in/yaml.v3"
+)
+
+// equivalent contents according to the compare strategy.
+// Contents which cannot be decoded are compared byte per byte: the error is returned if it is the new content.
+func equivalent(compare string, current, content []byte) (bool, error) {
+	switch compare {
+	case cfg.CompareWhitespace:
+		return bytes.Equal(trimWhitespaces(current), trimWhitespaces(content)), nil
+	case cfg.CompareJSON, cfg.CompareYAML:
+		values, err := decode(compare, content)
+		if err != nil {
+			return bytes.Equal(current, content), err
+		}
+		currentValues, err := decode(compare, current)
+		if err != nil {
+			return false, nil //nolint:nilerr // the current content is replaced
+		}
+		return reflect.DeepEqual(currentValues, values), nil
+	default:
+		return bytes.Equal(current, content), nil
+	}
+}
+
+// trimWhitespaces at the end of lines and trailing blank lines.
+func trimWhitespaces(content []byte) []byte {
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return []byte(strings.TrimRight(strings.Join(lines, "\n"), "\n"))
+}
+
+// decode the JSON value or the YAML documents of the content.
+func decode(compare string, content []byte) ([]any, error) {
+	if compare == cfg.CompareJSON {
+		// numbers are compared as written: large integers are not rounded as floats
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("decoding json: %v", err)
+		}
+		if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("decoding json: unexpected data after the value")
+		}
+		return []any{value}, nil
+	}
+	values := []any{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var value any
+		err := decoder.Decode(&value)
+		if errors.Is(err, io.EOF) {
+			return values, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding yaml: %v", err)
+		}
+		values = append(values, value)
+	}
+}
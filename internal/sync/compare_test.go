@@ -0,0 +1,44 @@
+package sync
+
+import (
+	"testing"
+
+	"gha-file-sync/internal/cfg"
+)
+
+func TestEquivalent(t *testing.T) {
+	tests := []struct {
+		name    string
+		compare string
+		current string
+		content string
+		want    bool
+		wantErr bool
+	}{
+		{name: "exact", compare: cfg.CompareExact, current: "a\n", content: "a\n", want: true},
+		{name: "exact difference", compare: cfg.CompareExact, current: "a \n", content: "a\n"},
+		{name: "empty is exact", current: "a \n", content: "a\n"},
+		{name: "trailing whitespaces", compare: cfg.CompareWhitespace, current: "a \t\r\nb\n\n\n", content: "a\nb\n", want: true},
+		{name: "leading whitespaces", compare: cfg.CompareWhitespace, current: " a\n", content: "a\n"},
+		{name: "json formatting and key order", compare: cfg.CompareJSON, current: `{"b": [1, 2], "a": "x"}`, content: "{\n  \"a\": \"x\",\n  \"b\": [1, 2]\n}\n", want: true},
+		{name: "json large integers", compare: cfg.CompareJSON, current: `{"id": 9007199254740993}`, content: `{"id": 9007199254740992}`},
+		{name: "json value difference", compare: cfg.CompareJSON, current: `{"a": 1}`, content: `{"a": 2}`},
+		{name: "json trailing data", compare: cfg.CompareJSON, current: `{"a": 1}`, content: `{"a": 1} {"a": 2}`, wantErr: true},
+		{name: "invalid new json", compare: cfg.CompareJSON, current: `{"a": 1}`, content: `{"a": 1`, wantErr: true},
+		{name: "invalid current json", compare: cfg.CompareJSON, current: `{"a": 1`, content: `{"a": 1}`},
+		{name: "yaml comments and key order", compare: cfg.CompareYAML, current: "# c\nb: 2\na: 1\n", content: "a: 1\nb: 2\n", want: true},
+		{name: "yaml documents", compare: cfg.CompareYAML, current: "a: 1\n---\nb: 2\n", content: "a: 1\n"},
+		{name: "invalid new yaml", compare: cfg.CompareYAML, current: "a: 1\n", content: "a: [1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := equivalent(tt.compare, []byte(tt.current), []byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("equivalent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("equivalent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
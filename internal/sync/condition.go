@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/log"
+	"gha-file-sync/internal/provider"
+)
+
+// targetRepo against which the binding conditions are evaluated.
+type targetRepo struct {
+	filePaths []string
+	getInfo   func() (provider.RepositoryInfo, error)
+	info      *provider.RepositoryInfo // got once needed
+}
+
+// newTargetRepo with its file paths, described by the provider only if a condition needs it.
+func newTargetRepo(ctx context.Context, p provider.Provider, owner, repoName string, filePaths []string) *targetRepo {
+	return &targetRepo{
+		filePaths: filePaths,
+		getInfo: func() (provider.RepositoryInfo, error) {
+			reader, ok := p.(provider.RepositoryInfoReader)
+			if !ok {
+				return provider.RepositoryInfo{}, fmt.Errorf("getting topics and language: %w", provider.ErrNotSupported)
+			}
+			return reader.GetRepositoryInfo(ctx, owner, repoName)
+		},
+	}
+}
+
+// applicableBindings to the target repository: the ones whose conditions are all met.
+// A binding whose conditions cannot be evaluated is not applied.
+func applicableBindings(bindings []cfg.FileBinding, repo *targetRepo) []cfg.FileBinding {
+	applicable := make([]cfg.FileBinding, 0, len(bindings))
+	for _, b := range bindings {
+		met, err := repo.meets(b.Conditions)
+		if err != nil {
+			log.Errorf("evaluating conditions of %s: %v", b, err)
+			continue
+		}
+		if !met {
+			log.Infof("-> %s skipped: conditions not met", b)
+			continue
+		}
+		applicable = append(applicable, b)
+	}
+	return applicable
+}
+
+// meets all the conditions.
+func (r *targetRepo) meets(conditions []cfg.Condition) (bool, error) {
+	for _, c := range conditions {
+		met, err := r.meet(c)
+		if err != nil || !met {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (r *targetRepo) meet(c cfg.Condition) (bool, error) {
+	switch c.Kind {
+	case cfg.ConditionExists:
+		return r.exists(c.Value), nil
+	case cfg.ConditionAbsent:
+		return !r.exists(c.Value), nil
+	case cfg.ConditionMatch:
+		return r.matches(c.Value), nil
+	}
+
+	if r.info == nil {
+		info, err := r.getInfo()
+		if err != nil {
+			return false, err
+		}
+		r.info = &info
+	}
+	switch c.Kind {
+	case cfg.ConditionTopic:
+		return slices.Contains(r.info.Topics, c.Value), nil
+	case cfg.ConditionLanguage:
+		return strings.EqualFold(r.info.Language, c.Value), nil
+	default:
+		return false, fmt.Errorf("unknown condition %s", c.Kind)
+	}
+}
+
+// exists as a file or a directory.
+func (r *targetRepo) exists(filePath string) bool {
+	filePath = cleanDest(filePath)
+	for _, p := range r.filePaths {
+		if p == filePath || strings.HasPrefix(p, filePath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matches any file with the glob pattern: a pattern without slash matches the file names at any depth.
+func (r *targetRepo) matches(pattern string) bool {
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	for _, p := range r.filePaths {
+		name := p
+		if !anchored {
+			name = path.Base(p)
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
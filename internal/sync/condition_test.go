@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/provider"
+)
+
+func TestMeets(t *testing.T) {
+	filePaths := []string{"go.mod", "cmd/main.go", "docs/guide/index.md", ".github/workflows/ci.yml"}
+	info := provider.RepositoryInfo{Topics: []string{"go", "cli"}, Language: "Go"}
+	tests := []struct {
+		name       string
+		conditions []cfg.Condition
+		infoErr    error
+		want       bool
+		wantErr    bool
+		wantInfo   bool // the repository info is needed
+	}{
+		{name: "no condition", want: true},
+		{name: "file exists", conditions: []cfg.Condition{{Kind: cfg.ConditionExists, Value: "go.mod"}}, want: true},
+		{name: "directory exists", conditions: []cfg.Condition{{Kind: cfg.ConditionExists, Value: "/docs/guide/"}}, want: true},
+		{name: "prefix is not a directory", conditions: []cfg.Condition{{Kind: cfg.ConditionExists, Value: "doc"}}},
+		{name: "absent", conditions: []cfg.Condition{{Kind: cfg.ConditionAbsent, Value: "package.json"}}, want: true},
+		{name: "not absent", conditions: []cfg.Condition{{Kind: cfg.ConditionAbsent, Value: "cmd"}}},
+		{name: "name match at any depth", conditions: []cfg.Condition{{Kind: cfg.ConditionMatch, Value: "*.md"}}, want: true},
+		{name: "anchored match", conditions: []cfg.Condition{{Kind: cfg.ConditionMatch, Value: "/.github/workflows/*.yml"}}, want: true},
+		{name: "anchored mismatch", conditions: []cfg.Condition{{Kind: cfg.ConditionMatch, Value: "docs/*.md"}}},
+		{
+			name:       "topic",
+			conditions: []cfg.Condition{{Kind: cfg.ConditionTopic, Value: "cli"}},
+			want:       true, wantInfo: true,
+		},
+		{
+			name:       "language case insensitive",
+			conditions: []cfg.Condition{{Kind: cfg.ConditionLanguage, Value: "go"}},
+			want:       true, wantInfo: true,
+		},
+		{
+			name:       "info not needed after an unmet condition",
+			conditions: []cfg.Condition{{Kind: cfg.ConditionExists, Value: "missing"}, {Kind: cfg.ConditionTopic, Value: "go"}},
+		},
+		{
+			name:       "info error",
+			conditions: []cfg.Condition{{Kind: cfg.ConditionTopic, Value: "go"}},
+			infoErr:    provider.ErrNotSupported, wantErr: true, wantInfo: true,
+		},
+		{
+			name:       "unknown condition",
+			conditions: []cfg.Condition{{Kind: "if-unknown", Value: "x"}},
+			wantErr:    true, wantInfo: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			infoCalls := 0
+			repo := &targetRepo{
+				filePaths: filePaths,
+				getInfo: func() (provider.RepositoryInfo, error) {
+					infoCalls++
+					return info, tt.infoErr
+				},
+			}
+			got, err := repo.meets(tt.conditions)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("meets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("meets() = %v, want %v", got, tt.want)
+			}
+			if (infoCalls > 0) != tt.wantInfo {
+				t.Errorf("repository info got %d times, want needed %v", infoCalls, tt.wantInfo)
+			}
+		})
+	}
+}
+
+func TestApplicableBindings(t *testing.T) {
+	bindings := []cfg.FileBinding{
+		{Source: "a", Dest: "a"},
+		{Source: "b", Dest: "b", Conditions: []cfg.Condition{{Kind: cfg.ConditionExists, Value: "go.mod"}}},
+		{Source: "c", Dest: "c", Conditions: []cfg.Condition{{Kind: cfg.ConditionAbsent, Value: "go.mod"}}},
+		{Source: "d", Dest: "d", Conditions: []cfg.Condition{{Kind: cfg.ConditionTopic, Value: "go"}}},
+		{Source: "e", Dest: "e", Conditions: []cfg.Condition{{Kind: cfg.ConditionLanguage, Value: "go"}}},
+	}
+	repo := &targetRepo{
+		filePaths: []string{"go.mod"},
+		getInfo: func() (provider.RepositoryInfo, error) {
+			return provider.RepositoryInfo{}, errors.New("unavailable")
+		},
+	}
+
+	dests := []string{}
+	for _, b := range applicableBindings(bindings, repo) {
+		dests = append(dests, b.Dest)
+	}
+	// bindings whose conditions cannot be evaluated are not applied
+	if want := []string{"a", "b"}; !reflect.DeepEqual(dests, want) {
+		t.Errorf("applicableBindings() = %v, want %v", dests, want)
+	}
+}
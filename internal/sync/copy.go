@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/log"
+)
+
+// copyBinding of its source, a file or a directory, to its destination in the target repository path.
+// Symbolic links are reproduced as is, file modes are reduced to what git records, 644 or 755, unless forced,
+// and contents are written as the target stores them. Existing files are kept according to the binding write policy,
+// or patched by the source of patch bindings.
+func copyBinding(sourcePath, targetPath string, b cfg.FileBinding, tgt target) error {
+	src := b.SourcePath(sourcePath)
+	dest := cleanDest(b.Dest)
+	return filepath.WalkDir(src, func(srcPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, srcPath)
+		if err != nil {
+			return err
+		}
+		filePath := path.Join(dest, filepath.ToSlash(relPath)) // in the repository
+		destPath := filepath.Join(targetPath, filePath)
+
+		sourceFile := path.Join(filepath.ToSlash(b.Source), filepath.ToSlash(relPath))
+		if !d.IsDir() {
+			keep, err := tgt.keeps(filePath, sourceFile, b)
+			if err != nil {
+				return err
+			}
+			if keep {
+				log.Infof("-> %s kept: write %s", filePath, b.Write)
+				return nil
+			}
+		}
+
+		switch {
+		case d.IsDir():
+			return copyDir(destPath)
+		case d.Type()&fs.ModeSymlink != 0:
+			return copySymlink(srcPath, destPath)
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			content, err := os.ReadFile(srcPath)
+			if err != nil {
+				return err
+			}
+			mode := info.Mode()
+			if b.Patch != "" {
+				var write bool
+				if content, write, err = tgt.patched(filePath, sourceFile, content, b); err != nil || !write {
+					return err
+				}
+				// a patched file keeps its mode
+				if current, err := os.Lstat(destPath); err == nil {
+					mode = current.Mode()
+				}
+			} else if content, err = tgt.content(filePath, srcPath, content, b); err != nil {
+				return err
+			}
+			return writeFile(destPath, content, fileMode(mode, b.Mode))
+		default:
+			log.Warnf("skipping %s: not a regular file", srcPath)
+			return nil
+		}
+	})
+}
+
+// copyDir creates the destination directory, replacing any file at its path.
+func copyDir(destPath string) error {
+	if info, err := os.Lstat(destPath); err == nil && !info.IsDir() {
+		if err := os.Remove(destPath); err != nil {
+			return err
+		}
+	}
+	return os.MkdirAll(destPath, 0o755) //nolint:gomnd
+}
+
+// copySymlink with the same target, relative or not, replacing anything at the destination path.
+func copySymlink(srcPath, destPath string) error {
+	target, err := os.Readlink(srcPath)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(destPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil { //nolint:gomnd
+		return err
+	}
+	return os.Symlink(target, destPath)
+}
+
+// writeFile content with the given mode: a link or a directory at the destination path is replaced,
+// never followed.
+func writeFile(destPath string, content []byte, mode fs.FileMode) error {
+	if info, err := os.Lstat(destPath); err == nil && !info.Mode().IsRegular() {
+		if err := os.RemoveAll(destPath); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil { //nolint:gomnd
+		return err
+	}
+	if err := os.WriteFile(destPath, content, mode); err != nil {
+		return err
+	}
+	// the mode of an existing file is kept by the write
+	if err := os.Chmod(destPath, mode); err != nil {
+		return fmt.Errorf("setting mode of %s: %v", destPath, err)
+	}
+	return nil
+}
+
+// fileMode of a copied file: the forced one, or executable if the source is executable by anyone.
+func fileMode(srcMode fs.FileMode, forcedMode string) fs.FileMode {
+	switch {
+	case forcedMode == cfg.FileModeExecutable:
+		return 0o755 //nolint:gomnd
+	case forcedMode == cfg.FileModeRegular:
+		return 0o644 //nolint:gomnd
+	case srcMode&0o111 != 0:
+		return 0o755 //nolint:gomnd
+	default:
+		return 0o644 //nolint:gomnd
+	}
+}
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/git"
+)
+
+func TestCopyBinding(t *testing.T) {
+	tests := []struct {
+		name       string
+		srcMode    fs.FileMode // of the source file, a link to target.txt if 0
+		mode       string      // forced by the binding
+		existing   string      // at the destination: file, executable, link or dir
+		wantMode   fs.FileMode // of the destination file
+		wantTarget string      // of the destination link, if a link is expected
+	}{
+		{name: "executable", srcMode: 0o755, wantMode: 0o755},
+		{name: "regular", srcMode: 0o644, wantMode: 0o644},
+		{name: "executable by group only", srcMode: 0o614, wantMode: 0o755},
+		{name: "group writable reduced", srcMode: 0o664, wantMode: 0o644},
+		{name: "forced executable", srcMode: 0o644, mode: cfg.FileModeExecutable, wantMode: 0o755},
+		{name: "forced regular", srcMode: 0o755, mode: cfg.FileModeRegular, wantMode: 0o644},
+		{name: "executable over a regular file", srcMode: 0o755, existing: "file", wantMode: 0o755},
+		{name: "regular over an executable file", srcMode: 0o644, existing: "executable", wantMode: 0o644},
+		{name: "file over a link", srcMode: 0o644, existing: "link", wantMode: 0o644},
+		{name: "file over a directory", srcMode: 0o644, existing: "dir", wantMode: 0o644},
+		{name: "relative link", wantTarget: "target.txt"},
+		{name: "link over a file", existing: "file", wantTarget: "target.txt"},
+		{name: "link over a directory", existing: "dir", wantTarget: "target.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sourceDir, targetDir := t.TempDir(), t.TempDir()
+			srcPath := filepath.Join(sourceDir, "src")
+			if tt.srcMode == 0 {
+				if err := os.Symlink("target.txt", srcPath); err != nil {
+					t.Fatalf("linking source: %v", err)
+				}
+			} else {
+				if err := os.WriteFile(srcPath, []byte("content\n"), tt.srcMode); err != nil {
+					t.Fatalf("writing source: %v", err)
+				}
+				if err := os.Chmod(srcPath, tt.srcMode); err != nil { // regardless of the umask
+					t.Fatalf("setting source mode: %v", err)
+				}
+			}
+
+			// the link at the destination would be followed to a file outside of the target
+			outside := filepath.Join(t.TempDir(), "outside.txt")
+			if err := os.WriteFile(outside, []byte("outside\n"), 0o644); err != nil {
+				t.Fatalf("writing outside file: %v", err)
+			}
+			destPath := filepath.Join(targetDir, "dest")
+			var err error
+			switch tt.existing {
+			case "file":
+				err = os.WriteFile(destPath, []byte("old\n"), 0o644)
+			case "executable":
+				err = os.WriteFile(destPath, []byte("old\n"), 0o755)
+			case "link":
+				err = os.Symlink(outside, destPath)
+			case "dir":
+				if err = os.Mkdir(destPath, 0o755); err == nil {
+					err = os.WriteFile(filepath.Join(destPath, "nested.txt"), nil, 0o644)
+				}
+			}
+			if err != nil {
+				t.Fatalf("creating existing %s: %v", tt.existing, err)
+			}
+
+			tgt := newTarget(git.Attributes{}, func(string) ([]byte, bool, error) { return nil, false, nil }, nil)
+			b := cfg.FileBinding{Source: "src", Dest: "dest", Mode: tt.mode}
+			if err := copyBinding(sourceDir, targetDir, b, tgt); err != nil {
+				t.Fatalf("copyBinding() error = %v", err)
+			}
+
+			info, err := os.Lstat(destPath)
+			if err != nil {
+				t.Fatalf("reading destination: %v", err)
+			}
+			if tt.wantTarget != "" {
+				target, err := os.Readlink(destPath)
+				if err != nil || target != tt.wantTarget {
+					t.Errorf("destination link = %q, %v, want a link to %q", target, err, tt.wantTarget)
+				}
+				return
+			}
+			if !info.Mode().IsRegular() || info.Mode().Perm() != tt.wantMode {
+				t.Errorf("destination mode = %v, want a regular file %v", info.Mode(), tt.wantMode)
+			}
+			if content, err := os.ReadFile(destPath); err != nil || string(content) != "content\n" {
+				t.Errorf("destination content = %q, %v, want %q", content, err, "content\n")
+			}
+			if content, err := os.ReadFile(outside); err != nil || string(content) != "outside\n" {
+				t.Errorf("file outside of the target = %q, %v, want it untouched", content, err)
+			}
+		})
+	}
+}
+
+func TestCopyBindingDirectory(t *testing.T) {
+	sourceDir, targetDir := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(sourceDir, "src", "bin"), 0o755); err != nil {
+		t.Fatalf("creating source: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "src", "bin", "run.sh"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("writing source: %v", err)
+	}
+	// a relative link inside the source directory
+	if err := os.Symlink("bin/run.sh", filepath.Join(sourceDir, "src", "run")); err != nil {
+		t.Fatalf("linking source: %v", err)
+	}
+
+	tgt := newTarget(git.Attributes{}, func(string) ([]byte, bool, error) { return nil, false, nil }, nil)
+	if err := copyBinding(sourceDir, targetDir, cfg.FileBinding{Source: "src", Dest: "tools"}, tgt); err != nil {
+		t.Fatalf("copyBinding() error = %v", err)
+	}
+
+	info, err := os.Lstat(filepath.Join(targetDir, "tools", "bin", "run.sh"))
+	if err != nil || info.Mode().Perm() != 0o755 {
+		t.Errorf("copied script = %v, %v, want mode 755", info, err)
+	}
+	if target, err := os.Readlink(filepath.Join(targetDir, "tools", "run")); err != nil || target != "bin/run.sh" {
+		t.Errorf("copied link = %q, %v, want a link to %q", target, err, "bin/run.sh")
+	}
+}
@@ -2,30 +2,54 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
 	"strings"
 
 	"gha-file-sync/internal/cfg"
-	"gha-file-sync/internal/github"
+	"gha-file-sync/internal/git"
 	"gha-file-sync/internal/log"
+	"gha-file-sync/internal/provider"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 )
 
-// Do synchronize one repository.
-func Do(ctx context.Context, repoFullname string, c *cfg.Config, ghClient *github.Client) error {
-	log.Infof("Syncing %s...", repoFullname)
+// Do synchronize one repository. The co-authors are credited on the commits if configured.
+func Do(ctx context.Context, repo cfg.Repository, c *cfg.Config, providers provider.Registry, coAuthors []git.Identity) error {
+	log.Infof("Syncing %s...", repo)
 
-	repoFullnameSplit := strings.Split(repoFullname, "/")
-	owner := repoFullnameSplit[0]
-	repoName := repoFullnameSplit[1]
+	p, err := providers.Get(ctx, repo.Provider, repo.Owner)
+	if err != nil {
+		return fmt.Errorf("getting provider: %v", err)
+	}
 
-	task, err := NewTask(
-		ctx,
-		owner, repoName,
-		c.FileSourcePath, c.Workspace,
-		c.GithubURL, c.GithubToken, ghClient,
-		c.FileSyncBranchRegexp,
-		c.FilesBindings,
-	)
+	// in direct mode or to a fixed push branch, the branch can move between the clone and the push:
+	// retry from scratch with a new clone in this case
+	for attempt := 0; ; attempt++ {
+		err = do(ctx, repo, c, p, coAuthors)
+		if !isRetried(c.SyncMode, c.PushBranch) || !errors.Is(err, git.ErrRemoteMoved) || attempt >= c.DirectPushRetries {
+			return err
+		}
+		log.Warnf("-> branch has moved during the sync, retrying (%d/%d)...", attempt+1, c.DirectPushRetries)
+	}
+}
+
+// syncer synchronizes one repository: Task with a local clone, APITask through the provider api.
+type syncer interface {
+	PickSyncBranch(ctx context.Context) error
+	HasChangedAfterCopy(ctx context.Context) (bool, error)
+	UpdateRemote(ctx context.Context, commitMsg, prTitle string) error
+	CleanAll(ctx context.Context) error
+}
+
+// do synchronize one repository with the given provider: clone, compare, update.
+func do(ctx context.Context, repo cfg.Repository, c *cfg.Config, p provider.Provider, coAuthors []git.Identity) error {
+	task, err := newSyncer(ctx, repo, c, p, coAuthors)
 	if err != nil {
 		return fmt.Errorf("creating task: %v", err)
 	}
@@ -34,7 +58,7 @@ func Do(ctx context.Context, repoFullname string, c *cfg.Config, ghClient *githu
 	defer func() {
 		cleanErr := task.CleanAll(ctx)
 		if cleanErr != nil {
-			log.Errorf("cleaning %s: %v", repoFullname, cleanErr)
+			log.Errorf("cleaning %s: %v", repo, cleanErr)
 		}
 	}()
 
@@ -57,7 +81,7 @@ func Do(ctx context.Context, repoFullname string, c *cfg.Config, ghClient *githu
 			log.Infof("-> dry run: no concrete write action.")
 		} else {
 			if err := task.UpdateRemote(ctx, c.CommitMessage, c.PRTitle); err != nil {
-				return fmt.Errorf("update remote repo: %v", err)
+				return fmt.Errorf("update remote repo: %w", err)
 			}
 		}
 	} else {
@@ -65,3 +89,112 @@ func Do(ctx context.Context, repoFullname string, c *cfg.Config, ghClient *githu
 	}
 	return nil
 }
+
+// newSyncer according to the configured sync engine.
+func newSyncer(ctx context.Context, repo cfg.Repository, c *cfg.Config, p provider.Provider, coAuthors []git.Identity) (syncer, error) {
+	if c.SyncEngine == cfg.SyncEngineAPI {
+		task, err := NewAPITask(
+			ctx,
+			repo.Owner, repo.Name,
+			newActionSource(c, repo),
+			p,
+			c.FileSyncBranchRegexp,
+			c.FilesBindings, c.TargetOptIn,
+			c.SyncMode, c.PushBranch,
+			git.Identity{Name: c.CommitAuthorName, Email: c.CommitAuthorEmail},
+			git.Identity{Name: c.CommitCommitterName, Email: c.CommitCommitterEmail},
+			c.CommitSignOff, coAuthors,
+		)
+		return &task, err
+	}
+
+	repoURL, gitAuth, err := remoteAccess(repo, c, p)
+	if err != nil {
+		return nil, fmt.Errorf("configuring git transport: %v", err)
+	}
+	commitSigner, err := newCommitSigner(c)
+	if err != nil {
+		return nil, fmt.Errorf("configuring commit signing: %v", err)
+	}
+	// cached clones are kept per provider
+	workspace := c.Workspace
+	if c.CloneCacheDir != "" {
+		workspace = path.Join(c.CloneCacheDir, string(repo.Provider))
+	}
+	task, err := NewTask(
+		ctx,
+		repo.Owner, repo.Name,
+		newActionSource(c, repo), workspace,
+		p,
+		repoURL, gitAuth,
+		c.FileSyncBranchRegexp,
+		c.FilesBindings, c.TargetOptIn,
+		c.SyncMode, c.PushBranch,
+		c.CommitSigning, commitSigner,
+		git.Identity{Name: c.CommitAuthorName, Email: c.CommitAuthorEmail},
+		git.Identity{Name: c.CommitCommitterName, Email: c.CommitCommitterEmail},
+		c.CommitSignOff, coAuthors,
+		cloneOptions(c),
+	)
+	return &task, err
+}
+
+// cloneOptions according to the configuration.
+// With sparse checkout, only the top-level directories containing the binding destinations are checked out:
+// nested directories cannot be checked out alone reliably.
+func cloneOptions(c *cfg.Config) git.CloneOptions {
+	opt := git.CloneOptions{Depth: c.CloneDepth, Cached: (c.CloneCacheDir != "")}
+	if !c.SparseCheckout {
+		return opt
+	}
+	for _, b := range c.FilesBindings {
+		dest := cleanDest(b.Dest)
+		// a file is bound: its directory is needed
+		if info, err := os.Stat(b.SourcePath(c.FileSourcePath)); err == nil && !info.IsDir() {
+			dest = cleanDest(path.Dir(dest))
+		}
+		// the repository root is bound: the whole tree is needed
+		if dest == "" {
+			opt.SparsePaths = nil
+			return opt
+		}
+		topDir, _, _ := strings.Cut(dest, "/")
+		if !slices.Contains(opt.SparsePaths, topDir+"/") {
+			opt.SparsePaths = append(opt.SparsePaths, topDir+"/")
+		}
+	}
+	sort.Strings(opt.SparsePaths)
+	return opt
+}
+
+// remoteAccess returns the URL and the authentication to clone and push the repository with the configured transport.
+// Over ssh, the repository deploy key is used first, then the configured private key, then the ssh agent.
+// The provider token is still used for its api.
+func remoteAccess(repo cfg.Repository, c *cfg.Config, p provider.Provider) (string, transport.AuthMethod, error) {
+	if c.GitTransport != cfg.GitTransportSSH {
+		return p.GetRepoURL(repo.Owner, repo.Name), p.GitAuth(), nil
+	}
+
+	privateKey, hasDeployKey := c.SSHDeployKeys[repo.FullName()]
+	if !hasDeployKey {
+		privateKey = c.SSHPrivateKey
+	}
+	auth, err := git.NewSSHAuth(privateKey, c.SSHPrivateKeyPassphrase, c.SSHKnownHosts)
+	if err != nil {
+		return "", nil, err
+	}
+	return p.GetSSHRepoURL(repo.Owner, repo.Name), auth, nil
+}
+
+// newCommitSigner returns the signer of local commits according to the configured commit signing, nil if none.
+// Commits created through the provider api are signed by the provider.
+func newCommitSigner(c *cfg.Config) (gogit.Signer, error) {
+	switch c.CommitSigning {
+	case cfg.CommitSigningGPG:
+		return git.NewGPGSigner(c.CommitSigningKey, c.CommitSigningKeyPassphrase)
+	case cfg.CommitSigningSSH:
+		return git.NewSSHSigner(c.CommitSigningKey, c.CommitSigningKeyPassphrase)
+	default:
+		return nil, nil
+	}
+}
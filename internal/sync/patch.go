@@ -0,0 +1,378 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/log"
+)
+
+// statuses of a patch on a target file.
+const (
+	patchApplied        = "applied"
+	patchAlreadyApplied = "already applied"
+	patchConflict       = "conflict"
+)
+
+// hunkHeaderRegexp of a unified diff: @@ -{OLD START}[,{OLD COUNT}] +{NEW START}[,{NEW COUNT}] @@.
+var hunkHeaderRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// patched content of the target file at filePath by the patch of the binding, read from sourceFile.
+// Nothing is to write if the patch is already applied or conflicts, the file being missing or different:
+// the status is logged and reported either way.
+func (t target) patched(filePath, sourceFile string, patchContent []byte, b cfg.FileBinding) ([]byte, bool, error) {
+	// a file patched by several bindings gets all the patches
+	current, exists := t.patchedFiles[filePath]
+	if !exists {
+		var err error
+		if current, exists, err = t.readFile(filePath); err != nil {
+			return nil, false, err
+		}
+	}
+
+	content, status := current, patchConflict
+	if exists {
+		var err error
+		if content, status, err = applyPatch(b.Patch, current, patchContent); err != nil {
+			return nil, false, fmt.Errorf("applying %s: %v", sourceFile, err)
+		}
+	}
+	t.patchReports[fmt.Sprintf("Patch %s on %s", sourceFile, filePath)] = status
+
+	switch status {
+	case patchApplied:
+		log.Infof("-> patch %s applied on %s", sourceFile, filePath)
+		t.patchedFiles[filePath] = content
+		return content, true, nil
+	case patchAlreadyApplied:
+		log.Infof("-> patch %s already applied on %s", sourceFile, filePath)
+	default:
+		log.Warnf("-> patch %s conflicts with %s: left untouched", sourceFile, filePath)
+	}
+	return nil, false, nil
+}
+
+// sortedPatchReports of the patched files: one line per patch and file with its status.
+func (t target) sortedPatchReports() []string {
+	reports := make([]string, 0, len(t.patchReports))
+	for patch, status := range t.patchReports {
+		reports = append(reports, fmt.Sprintf("%s: %s", patch, status))
+	}
+	sort.Strings(reports)
+	return reports
+}
+
+// withPatchReports recorded in the commit message, if any.
+func withPatchReports(commitMsg string, reports []string) string {
+	if len(reports) == 0 {
+		return commitMsg
+	}
+	return fmt.Sprintf("%s\n\n%s", commitMsg, strings.Join(reports, "\n"))
+}
+
+// applyPatch of the given kind on the content: a unified diff or regexp replacements.
+func applyPatch(kind string, content, patchContent []byte) ([]byte, string, error) {
+	if kind == cfg.PatchRegexp {
+		replacements, err := parseReplacements(patchContent)
+		if err != nil {
+			return nil, "", err
+		}
+		patched, status := applyReplacements(content, replacements)
+		return patched, status, nil
+	}
+	hunks, err := parseDiff(patchContent)
+	if err != nil {
+		return nil, "", err
+	}
+	patched, status := applyDiff(content, hunks)
+	return patched, status, nil
+}
+
+// hunk of a unified diff.
+type hunk struct {
+	oldStart int // first line, from 1, 0 for an empty file
+	oldLines []string
+	newLines []string
+	atEnd    bool // no trailing context: the hunk ends at the end of the file
+	atStart  bool // the hunk starts at the beginning of the file
+}
+
+// parseDiff hunks of a unified diff: the file headers are ignored.
+func parseDiff(patchContent []byte) ([]hunk, error) {
+	hunks := []hunk{}
+	scanner := bufio.NewScanner(bytes.NewReader(patchContent))
+	for scanner.Scan() {
+		match := hunkHeaderRegexp.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		h := hunk{}
+		h.oldStart, _ = strconv.Atoi(match[1])
+		oldCount, newCount := hunkCount(match[2]), hunkCount(match[4])
+		h.atStart = (h.oldStart <= 1)
+
+		trailing := 0
+		for len(h.oldLines) < oldCount || len(h.newLines) < newCount {
+			if !scanner.Scan() {
+				return nil, fmt.Errorf("truncated hunk at line %d", h.oldStart)
+			}
+			line := strings.TrimSuffix(scanner.Text(), "\r")
+			switch {
+			case strings.HasPrefix(line, `\`):
+				continue // no newline at end of file
+			case strings.HasPrefix(line, "-"):
+				h.oldLines = append(h.oldLines, line[1:])
+				trailing = 0
+			case strings.HasPrefix(line, "+"):
+				h.newLines = append(h.newLines, line[1:])
+				trailing = 0
+			default:
+				// editors may strip the space of blank context lines
+				h.oldLines = append(h.oldLines, strings.TrimPrefix(line, " "))
+				h.newLines = append(h.newLines, strings.TrimPrefix(line, " "))
+				trailing++
+			}
+		}
+		h.atEnd = (trailing == 0 && len(h.oldLines) > 0)
+		hunks = append(hunks, h)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("no hunk found in the diff")
+	}
+	return hunks, nil
+}
+
+// hunkCount of lines in a hunk header: 1 if omitted.
+func hunkCount(countStr string) int {
+	if countStr == "" {
+		return 1
+	}
+	count, _ := strconv.Atoi(countStr)
+	return count
+}
+
+// applyDiff hunks on the content, where they match the nearest to their position.
+// A hunk whose result is found instead is already applied: the content is unchanged if a hunk matches neither.
+// The lines are matched regardless of their line ending, the added ones end as the content does.
+func applyDiff(content []byte, hunks []hunk) ([]byte, string) {
+	hasFinalNewline := bytes.HasSuffix(content, []byte("\n"))
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if len(content) == 0 {
+		lines = []string{}
+	}
+	lineEnd := ""
+	if bytes.Contains(content, []byte("\r\n")) {
+		lineEnd = "\r"
+	}
+
+	applied := false
+	pos, offset := 0, 0
+	for _, h := range hunks {
+		expected := h.oldStart - 1 + offset
+		// an addition to an empty context matches anywhere: its result is looked for first
+		if len(h.oldLines) == 0 {
+			if i := findLines(lines, h.newLines, pos, expected, h); i >= 0 {
+				pos = i + len(h.newLines)
+				continue
+			}
+		}
+		if i := findLines(lines, h.oldLines, pos, expected, h); i >= 0 {
+			newLines := make([]string, 0, len(h.newLines))
+			for _, line := range h.newLines {
+				newLines = append(newLines, line+lineEnd)
+			}
+			lines = append(lines[:i], append(newLines, lines[i+len(h.oldLines):]...)...)
+			pos = i + len(h.newLines)
+			offset += len(h.newLines) - len(h.oldLines)
+			applied = true
+			continue
+		}
+		if i := findLines(lines, h.newLines, pos, expected, h); i >= 0 {
+			pos = i + len(h.newLines)
+			continue
+		}
+		return content, patchConflict
+	}
+	if !applied {
+		return content, patchAlreadyApplied
+	}
+
+	patched := strings.Join(lines, "\n")
+	if hasFinalNewline || len(content) == 0 {
+		patched += "\n"
+	}
+	return []byte(patched), patchApplied
+}
+
+// findLines block in lines from the given index, the nearest to the expected one, respecting the hunk anchors:
+// -1 if not found.
+func findLines(lines, block []string, from, expected int, h hunk) int {
+	found := -1
+	for i := from; i+len(block) <= len(lines); i++ {
+		if (h.atStart && i != 0) || (h.atEnd && i+len(block) != len(lines)) {
+			continue
+		}
+		if !equalLines(lines[i:i+len(block)], block) {
+			continue
+		}
+		if found < 0 || abs(i-expected) < abs(found-expected) {
+			found = i
+		}
+	}
+	return found
+}
+
+// equalLines without their carriage return.
+func equalLines(lines, block []string) bool {
+	for i := range block {
+		if strings.TrimSuffix(lines[i], "\r") != block[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// replacement of the matches of a regexp, as in a sed substitution.
+type replacement struct {
+	regexp   *regexp.Regexp
+	template string // expanded by regexp.Expand
+}
+
+// parseReplacements, one per line: s{DELIMITER}{REGEXP}{DELIMITER}{REPLACEMENT}{DELIMITER}.
+// The delimiter is escaped with a backslash. Blank lines and lines starting with # are ignored.
+// As in sed, \N references a group and & the match in the replacement, ${N} is also supported.
+// Any other $ is literal.
+func parseReplacements(patchContent []byte) ([]replacement, error) {
+	replacements := []replacement{}
+	for i, line := range strings.Split(string(patchContent), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(line) < 4 || line[0] != 's' { //nolint:gomnd
+			return nil, fmt.Errorf("invalid replacement at line %d: s/{REGEXP}/{REPLACEMENT}/ expected", i+1)
+		}
+		parts := splitUnescaped(line[2:], line[1])
+		if len(parts) != 3 || parts[2] != "" { //nolint:gomnd
+			return nil, fmt.Errorf("invalid replacement at line %d: s/{REGEXP}/{REPLACEMENT}/ expected", i+1)
+		}
+		re, err := regexp.Compile(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp at line %d: %v", i+1, err)
+		}
+		replacements = append(replacements, replacement{regexp: re, template: sedTemplate(parts[1])})
+	}
+	if len(replacements) == 0 {
+		return nil, fmt.Errorf("no replacement found")
+	}
+	return replacements, nil
+}
+
+// splitUnescaped s around the delimiter, except where escaped with a backslash.
+// The other escaped characters, including backslashes, are kept escaped.
+func splitUnescaped(s string, delimiter byte) []string {
+	parts := []string{}
+	var part strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == delimiter:
+			part.WriteByte(delimiter)
+			i++
+		case s[i] == '\\' && i+1 < len(s):
+			part.WriteString(s[i : i+2])
+			i++
+		case s[i] == delimiter:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(s[i])
+		}
+	}
+	return append(parts, part.String())
+}
+
+// groupRefRegexp of a replacement: ${N}.
+var groupRefRegexp = regexp.MustCompile(`^\$\{\d+\}`)
+
+// sedTemplate of a sed replacement, for regexp.Expand: \N and & become ${N} and ${0}, \& and \\ are literal,
+// and so is $ unless it starts a ${N} reference: $VAR or ${VAR} are kept as written.
+func sedTemplate(sedReplacement string) string {
+	var template strings.Builder
+	for i := 0; i < len(sedReplacement); i++ {
+		c := sedReplacement[i]
+		switch {
+		case c == '$' && groupRefRegexp.MatchString(sedReplacement[i:]):
+			template.WriteByte(c)
+		case c == '$':
+			template.WriteString("$$")
+		case c == '&':
+			template.WriteString("${0}")
+		case c == '\\' && i+1 < len(sedReplacement) && sedReplacement[i+1] >= '0' && sedReplacement[i+1] <= '9':
+			fmt.Fprintf(&template, "${%c}", sedReplacement[i+1])
+			i++
+		case c == '\\' && i+1 < len(sedReplacement) && (sedReplacement[i+1] == '&' || sedReplacement[i+1] == '\\'):
+			template.WriteByte(sedReplacement[i+1])
+			i++
+		default:
+			template.WriteByte(c)
+		}
+	}
+	return template.String()
+}
+
+// applyReplacements of all the matches, in order: the patch is already applied if nothing is replaced.
+func applyReplacements(content []byte, replacements []replacement) ([]byte, string) {
+	patched := content
+	for _, r := range replacements {
+		patched = r.replaceAll(patched)
+	}
+	if bytes.Equal(patched, content) {
+		return content, patchAlreadyApplied
+	}
+	return patched, patchApplied
+}
+
+// replaceAll matches of the content, except the ones already replaced: the ones inside their own replacement,
+// for instance foo in foo-bar replacing foo, not to replace them again at each sync.
+func (r replacement) replaceAll(content []byte) []byte {
+	var replaced bytes.Buffer
+	last := 0
+	for _, match := range r.regexp.FindAllSubmatchIndex(content, -1) {
+		start, end := match[0], match[1]
+		output := r.regexp.Expand(nil, []byte(r.template), content, match)
+		if isReplaced(content, start, end, output) {
+			continue
+		}
+		replaced.Write(content[last:start])
+		replaced.Write(output)
+		last = end
+	}
+	replaced.Write(content[last:])
+	return replaced.Bytes()
+}
+
+// isReplaced match from start to end of the content: the output already surrounds it.
+func isReplaced(content []byte, start, end int, output []byte) bool {
+	for i := max(0, end-len(output)); i <= start && i+len(output) <= len(content); i++ {
+		if bytes.Equal(content[i:i+len(output)], output) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package sync
+
+import "testing"
+
+func TestParseReplacements(t *testing.T) {
+	tests := []struct {
+		name         string
+		patch        string
+		wantRegexps  []string
+		wantTemplate []string
+		wantErr      bool
+	}{
+		{name: "replacement", patch: "s/foo/bar/\n", wantRegexps: []string{"foo"}, wantTemplate: []string{"bar"}},
+		{
+			name:        "comments and blank lines",
+			patch:       "# versions\n\ns/v1/v2/\n  s|a|b|  \n",
+			wantRegexps: []string{"v1", "a"}, wantTemplate: []string{"v2", "b"},
+		},
+		{name: "escaped delimiter", patch: `s/a\/b/c\/d/`, wantRegexps: []string{"a/b"}, wantTemplate: []string{"c/d"}},
+		{name: "sed groups", patch: `s/(\w+)=(\w+)/\2=\1/`, wantRegexps: []string{`(\w+)=(\w+)`}, wantTemplate: []string{"${2}=${1}"}},
+		{name: "go groups", patch: `s/(\w+)=(\w+)/${2}=${1}/`, wantRegexps: []string{`(\w+)=(\w+)`}, wantTemplate: []string{"${2}=${1}"}},
+		{name: "sed match", patch: `s/v\d+/[&] \& \\/`, wantRegexps: []string{`v\d+`}, wantTemplate: []string{`[${0}] & \`}},
+		{name: "escaped backslash before the delimiter", patch: `s/a\\/b/`, wantRegexps: []string{`a\\`}, wantTemplate: []string{"b"}},
+		{name: "empty replacement", patch: "s/foo//", wantRegexps: []string{"foo"}, wantTemplate: []string{""}},
+		{
+			name: "variables", patch: `s/run: old/run: new $ARGS ${HOME} $1/`,
+			wantRegexps: []string{"run: old"}, wantTemplate: []string{"run: new $$ARGS $${HOME} $$1"},
+		},
+		{name: "literal dollar", patch: `s/price/$ 5$/`, wantRegexps: []string{"price"}, wantTemplate: []string{"$$ 5$$"}},
+		{name: "no replacement", patch: "# nothing\n", wantErr: true},
+		{name: "not a substitution", patch: "y/abc/def/", wantErr: true},
+		{name: "missing delimiter", patch: "s/foo/bar", wantErr: true},
+		{name: "trailing flags", patch: "s/foo/bar/g", wantErr: true},
+		{name: "invalid regexp", patch: "s/(/bar/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseReplacements([]byte(tt.patch))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseReplacements() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.wantRegexps) {
+				t.Fatalf("parseReplacements() = %d replacements, want %d", len(got), len(tt.wantRegexps))
+			}
+			for i, r := range got {
+				if r.regexp.String() != tt.wantRegexps[i] || r.template != tt.wantTemplate[i] {
+					t.Errorf("replacement %d = %s, %s, want %s, %s", i, r.regexp, r.template, tt.wantRegexps[i], tt.wantTemplate[i])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyReplacements(t *testing.T) {
+	tests := []struct {
+		name       string
+		patch      string
+		content    string
+		want       string
+		wantStatus string
+	}{
+		{name: "all matches", patch: "s/v1/v2/", content: "v1 v1\n", want: "v2 v2\n", wantStatus: patchApplied},
+		{name: "in order", patch: "s/a/b/\ns/b/c/", content: "a\n", want: "c\n", wantStatus: patchApplied},
+		{name: "sed groups", patch: `s/(\w+)=(\w+)/\2=\1/`, content: "a=b\n", want: "b=a\n", wantStatus: patchApplied},
+		{name: "sed match", patch: `s/v\d+/[&]/`, content: "v1\n", want: "[v1]\n", wantStatus: patchApplied},
+		{name: "nothing to replace", patch: "s/v1/v2/", content: "v2\n", want: "v2\n", wantStatus: patchAlreadyApplied},
+		{name: "replacement matching the regexp", patch: "s/foo/foo-bar/", content: "foo\n", want: "foo-bar\n", wantStatus: patchApplied},
+		{
+			name: "replacement matching the regexp applied again", patch: "s/foo/foo-bar/",
+			content: "foo-bar\n", want: "foo-bar\n", wantStatus: patchAlreadyApplied,
+		},
+		{
+			name: "replacement before the match applied again", patch: "s/bar/foo-bar/",
+			content: "foo-bar bar\n", want: "foo-bar foo-bar\n", wantStatus: patchApplied,
+		},
+		{name: "removal", patch: "s/ *# TODO//", content: "a # TODO\n", want: "a\n", wantStatus: patchApplied},
+		{
+			name: "variables", patch: `s/run: old/run: new $ARGS >> ${GITHUB_ENV}/`,
+			content: "run: old\n", want: "run: new $ARGS >> ${GITHUB_ENV}\n", wantStatus: patchApplied,
+		},
+		{name: "literal dollar", patch: `s/(\d+) USD/$\1 $/`, content: "5 USD\n", want: "$5 $\n", wantStatus: patchApplied},
+		{name: "go group next to a dollar", patch: `s/(\d+) USD/$${1}/`, content: "5 USD\n", want: "$5\n", wantStatus: patchApplied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replacements, err := parseReplacements([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("parseReplacements() error = %v", err)
+			}
+			got, status := applyReplacements([]byte(tt.content), replacements)
+			if string(got) != tt.want || status != tt.wantStatus {
+				t.Errorf("applyReplacements() = %q, %s, want %q, %s", got, status, tt.want, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestApplyDiff(t *testing.T) {
+	diff := "--- a/conf\n+++ b/conf\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"
+	tests := []struct {
+		name       string
+		diff       string
+		content    string
+		want       string
+		wantStatus string
+	}{
+		{name: "applied", diff: diff, content: "a\nb\nc\n", want: "a\nB\nc\n", wantStatus: patchApplied},
+		{name: "already applied", diff: diff, content: "a\nB\nc\n", want: "a\nB\nc\n", wantStatus: patchAlreadyApplied},
+		{name: "conflict", diff: diff, content: "a\nx\nc\n", want: "a\nx\nc\n", wantStatus: patchConflict},
+		{name: "not at the start", diff: diff, content: "0\na\nb\nc\n", want: "0\na\nb\nc\n", wantStatus: patchConflict},
+		{
+			name: "moved", diff: "@@ -3,3 +3,3 @@\n a\n-b\n+B\n c\n",
+			content: "0\n0\n0\na\nb\nc\nd\n", want: "0\n0\n0\na\nB\nc\nd\n", wantStatus: patchApplied,
+		},
+		{
+			name: "nearest match", diff: "@@ -5,3 +5,3 @@\n a\n-b\n+B\n c\n",
+			content: "a\nb\nc\n0\na\nb\nc\n", want: "a\nb\nc\n0\na\nB\nc\n", wantStatus: patchApplied,
+		},
+		{name: "without final newline", diff: diff, content: "a\nb\nc", want: "a\nB\nc", wantStatus: patchApplied},
+		{name: "crlf target", diff: diff, content: "a\r\nb\r\nc\r\n", want: "a\r\nB\r\nc\r\n", wantStatus: patchApplied},
+		{name: "crlf target already applied", diff: diff, content: "a\r\nB\r\nc\r\n", want: "a\r\nB\r\nc\r\n", wantStatus: patchAlreadyApplied},
+		{
+			name: "crlf diff", diff: "@@ -1,3 +1,3 @@\r\n a\r\n-b\r\n+B\r\n c\r\n",
+			content: "a\nb\nc\n", want: "a\nB\nc\n", wantStatus: patchApplied,
+		},
+		{
+			name: "addition at the start", diff: "@@ -1,1 +1,2 @@\n+#!/bin/sh\n a\n",
+			content: "a\nb\n", want: "#!/bin/sh\na\nb\n", wantStatus: patchApplied,
+		},
+		{
+			name: "addition at the end", diff: "@@ -2,1 +2,2 @@\n b\n+c\n",
+			content: "a\nb\n", want: "a\nb\nc\n", wantStatus: patchApplied,
+		},
+		{
+			name: "addition at the end not matching before", diff: "@@ -2,1 +2,2 @@\n b\n+c\n",
+			content: "b\na\n", want: "b\na\n", wantStatus: patchConflict,
+		},
+		{
+			name: "several hunks", diff: "@@ -1,2 +1,2 @@\n-a\n+A\n b\n@@ -4,2 +4,2 @@\n d\n-e\n+E\n",
+			content: "a\nb\nc\nd\ne\n", want: "A\nb\nc\nd\nE\n", wantStatus: patchApplied,
+		},
+		{
+			name: "one hunk already applied", diff: "@@ -1,2 +1,2 @@\n-a\n+A\n b\n@@ -4,2 +4,2 @@\n d\n-e\n+E\n",
+			content: "A\nb\nc\nd\ne\n", want: "A\nb\nc\nd\nE\n", wantStatus: patchApplied,
+		},
+		{name: "empty file", diff: "@@ -0,0 +1 @@\n+a\n", content: "", want: "a\n", wantStatus: patchApplied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks, err := parseDiff([]byte(tt.diff))
+			if err != nil {
+				t.Fatalf("parseDiff() error = %v", err)
+			}
+			got, status := applyDiff([]byte(tt.content), hunks)
+			if string(got) != tt.want || status != tt.wantStatus {
+				t.Errorf("applyDiff() = %q, %s, want %q, %s", got, status, tt.want, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestParseDiffErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+	}{
+		{name: "no hunk", diff: "--- a/conf\n+++ b/conf\n"},
+		{name: "truncated hunk", diff: "@@ -1,3 +1,3 @@\n a\n-b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseDiff([]byte(tt.diff)); err == nil {
+				t.Errorf("parseDiff() error = nil, want an error")
+			}
+		})
+	}
+}
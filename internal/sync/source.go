@@ -0,0 +1,170 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/git"
+	"gha-file-sync/internal/log"
+	"gha-file-sync/internal/provider"
+)
+
+// sourcesDir in the workspace where the sources are exported or cloned.
+const sourcesDir = ".sources"
+
+// PrepareSources of the bindings, recording them in the commit message when they are not the working directory:
+// - the bindings from the action repository are exported from the configured source ref, if any.
+// - the bindings from other repositories are cloned, once per repository and ref.
+// The bindings are updated with their local source directory.
+func PrepareSources(ctx context.Context, c *cfg.Config, providers provider.Registry) error {
+	sources := []string{}
+
+	// the write policy if-unchanged-since-last-sync compares with all the versions of the source files
+	fullHistory := map[string]bool{} // by repository and ref
+	for _, b := range c.FilesBindings {
+		if b.Write != cfg.WriteIfUnchanged {
+			continue
+		}
+		if b.SourceRepo != nil {
+			fullHistory[fmt.Sprintf("%s@%s", b.SourceRepo, b.SourceRef)] = true
+			continue
+		}
+		shallow, err := git.IsShallow(c.FileSourcePath)
+		if err != nil {
+			return fmt.Errorf("getting history of the source: %v", err)
+		}
+		if shallow {
+			return fmt.Errorf("write %s of %s requires the whole history of the source: checkout with fetch-depth: 0", b.Write, b)
+		}
+	}
+
+	if c.SourceRef != "" {
+		exportDir := path.Join(c.Workspace, sourcesDir, "local")
+		paths := []string{}
+		for _, b := range c.FilesBindings {
+			if b.SourceRepo == nil {
+				paths = append(paths, b.Source)
+			}
+		}
+		commitHash, err := git.ExportSource(c.FileSourcePath, c.SourceRef, paths, exportDir)
+		if err != nil {
+			return fmt.Errorf("exporting source at %s: %v", c.SourceRef, err)
+		}
+		for i, b := range c.FilesBindings {
+			if b.SourceRepo == nil {
+				c.FilesBindings[i].SourceDir = exportDir
+			}
+		}
+		log.Infof("source exported at %s (%s)", c.SourceRef, commitHash)
+		c.SourceCommit = commitHash
+		sources = append(sources, sourceLine(c.SourceRef, commitHash))
+	}
+
+	cloneDirs := map[string]string{} // by repository and ref
+	for i, b := range c.FilesBindings {
+		if b.SourceRepo == nil {
+			continue
+		}
+		key := fmt.Sprintf("%s@%s", b.SourceRepo, b.SourceRef)
+		cloneDir, isCloned := cloneDirs[key]
+		if !isCloned {
+			cloneDir = path.Join(c.Workspace, sourcesDir, strconv.Itoa(len(cloneDirs)))
+			commitHash, err := cloneSource(ctx, cloneDir, *b.SourceRepo, b.SourceRef, fullHistory[key], c, providers)
+			if err != nil {
+				return fmt.Errorf("cloning source %s: %v", key, err)
+			}
+			cloneDirs[key] = cloneDir
+			sources = append(sources, sourceLine(key, commitHash))
+		}
+		c.FilesBindings[i].SourceDir = cloneDir
+	}
+
+	// the commit message is also the PR body
+	if len(sources) > 0 {
+		c.CommitMessage = fmt.Sprintf("%s\n\n%s", c.CommitMessage, strings.Join(sources, "\n"))
+	}
+	return nil
+}
+
+// sourceLine recording a source in the commit message.
+func sourceLine(ref, commitHash string) string {
+	return fmt.Sprintf("Source: %s (%s)", ref, commitHash)
+}
+
+// actionSource of the bindings without source repository: the action repository.
+type actionSource struct {
+	path      string // work tree of the action repository
+	line      string // source recorded in the commit message, empty for the work tree
+	pinDir    string // export directory of the source pinned by the target repository
+	coAuthors bool   // the last authors of the source files are credited
+}
+
+// newActionSource for the target repository, once the sources are prepared.
+func newActionSource(c *cfg.Config, repo cfg.Repository) actionSource {
+	src := actionSource{
+		path:      c.FileSourcePath,
+		pinDir:    path.Join(c.Workspace, sourcesDir, "pinned", repo.Owner, repo.Name),
+		coAuthors: c.CommitCoAuthors,
+	}
+	if c.SourceRef != "" {
+		src.line = sourceLine(c.SourceRef, c.SourceCommit)
+	}
+	return src
+}
+
+// cloneSource repository at the given ref with the configured transport, with its whole history if required,
+// and returns the cloned commit hash.
+func cloneSource(
+	ctx context.Context, cloneDir string, repo cfg.Repository, ref string, fullHistory bool,
+	c *cfg.Config, providers provider.Registry,
+) (string, error) {
+	p, err := providers.Get(ctx, repo.Provider, repo.Owner)
+	if err != nil {
+		return "", fmt.Errorf("getting provider: %v", err)
+	}
+	repoURL, gitAuth, err := remoteAccess(repo, c, p)
+	if err != nil {
+		return "", fmt.Errorf("configuring git transport: %v", err)
+	}
+	commitHash, err := git.CloneSource(ctx, cloneDir, repoURL, ref, gitAuth, fullHistory)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("source %s cloned at %s", repo, commitHash)
+	return commitHash, nil
+}
+
+// CleanSources prepared by PrepareSources.
+func CleanSources(c *cfg.Config) error {
+	return os.RemoveAll(path.Join(c.Workspace, sourcesDir))
+}
+
+// fileHistories of the source files, by repository directory and file:
+// the sources do not change during a run, their history is read once for all the target repositories.
+var fileHistories = map[string][][]byte{}
+
+// sourceHistory of the bound source files, in the action repository at actionDir or in the source repository clone:
+// the history of other repositories is limited to their cloned commit.
+func sourceHistory(actionDir string) func(b cfg.FileBinding, sourceFile string) ([][]byte, error) {
+	return func(b cfg.FileBinding, sourceFile string) ([][]byte, error) {
+		dir := actionDir
+		if b.SourceRepo != nil {
+			dir = b.SourceDir
+		}
+		key := dir + "\x00" + sourceFile
+		if versions, isRead := fileHistories[key]; isRead {
+			return versions, nil
+		}
+		versions, err := git.FileHistory(dir, sourceFile)
+		if err != nil {
+			return nil, err
+		}
+		fileHistories[key] = versions
+		return versions, nil
+	}
+}
@@ -0,0 +1,33 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+
+	"gha-file-sync/internal/cfg"
+
+	gogit "github.com/go-git/go-git/v5"
+)
+
+func TestSourceHistory(t *testing.T) {
+	actionDir := t.TempDir()
+	if _, err := gogit.PlainInit(actionDir, false); err != nil {
+		t.Fatalf("initing repository: %v", err)
+	}
+	commitSource(t, actionDir, "a", map[string]string{"a.txt": "1"})
+	commitSource(t, actionDir, "a", map[string]string{"a.txt": "2"})
+
+	history := sourceHistory(actionDir)
+	b := cfg.FileBinding{Source: "a.txt", Dest: "a.txt", Write: cfg.WriteIfUnchanged}
+	want := [][]byte{[]byte("2"), []byte("1")}
+	got, err := history(b, "a.txt")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("sourceHistory() = %q, %v, want %q", got, err, want)
+	}
+
+	// read once for all the target repositories
+	commitSource(t, actionDir, "a", map[string]string{"a.txt": "3"})
+	if got, err := sourceHistory(actionDir)(b, "a.txt"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("sourceHistory() = %q, %v, want the cached %q", got, err, want)
+	}
+}
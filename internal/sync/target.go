@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/git"
+	"gha-file-sync/internal/log"
+	"gha-file-sync/internal/provider"
+)
+
+// lfsHTTPClient uploading the LFS objects.
+var lfsHTTPClient = &nethttp.Client{}
+
+// target repository tree on the sync branch, to write files as they would be stored there.
+type target struct {
+	attrs git.Attributes
+	// readFile at filePath in the sync branch head
+	readFile func(filePath string) (content []byte, exists bool, err error)
+	// sourceHistory of the bound source file, at sourceFile relative to the binding source root
+	sourceHistory func(b cfg.FileBinding, sourceFile string) ([][]byte, error)
+	// lfsObjects referenced by the written pointers, by oid
+	lfsObjects map[string]git.LFSObject
+	// patchedFiles content by path, for the following patches to apply on it
+	patchedFiles map[string][]byte
+	// patchReports status by patch and file
+	patchReports map[string]string
+}
+
+// newTarget with the given attributes, reader of the sync branch files and of the source files history.
+func newTarget(
+	attrs git.Attributes,
+	readFile func(filePath string) ([]byte, bool, error),
+	sourceHistory func(b cfg.FileBinding, sourceFile string) ([][]byte, error),
+) target {
+	return target{
+		attrs:         attrs,
+		readFile:      readFile,
+		sourceHistory: sourceHistory,
+		lfsObjects:    map[string]git.LFSObject{},
+		patchedFiles:  map[string][]byte{},
+		patchReports:  map[string]string{},
+	}
+}
+
+// lfsEndpoint of the target repository at repoURL, as set by its .lfsconfig file if any.
+func (t target) lfsEndpoint(repoURL string) (string, error) {
+	lfsConfig, _, err := t.readFile(git.LFSConfigPath)
+	if err != nil {
+		return "", err
+	}
+	return git.LFSEndpoint(repoURL, lfsConfig)
+}
+
+// uploadLFSObjects referenced by the written pointers to the LFS server at the endpoint, before they are pushed.
+// The git credentials of the target repository are only sent to its host.
+func uploadLFSObjects(
+	ctx context.Context,
+	p provider.Provider, owner, repoName, endpoint string,
+	objects []git.LFSObject,
+) error {
+	auth := p.GitAuth()
+	if !sameHost(p.GetRepoURL(owner, repoName), endpoint) {
+		auth = nil
+	}
+	return git.UploadLFSObjects(ctx, lfsHTTPClient, endpoint, auth, objects)
+}
+
+// sameHost of both urls.
+func sameHost(url1, url2 string) bool {
+	u1, err1 := url.Parse(url1)
+	u2, err2 := url.Parse(url2)
+	return err1 == nil && err2 == nil && strings.EqualFold(u1.Host, u2.Host)
+}
+
+// keeps the current file at filePath instead of writing its source, according to the binding write policy:
+// - if-missing: the file exists.
+// - if-unchanged-since-last-sync: the file exists and matches none of the versions of its source,
+// it has been changed in the target.
+func (t target) keeps(filePath, sourceFile string, b cfg.FileBinding) (bool, error) {
+	if b.Write == "" || b.Write == cfg.WriteAlways {
+		return false, nil
+	}
+	current, exists, err := t.readFile(filePath)
+	if err != nil || !exists {
+		return false, err
+	}
+	if b.Write == cfg.WriteIfMissing {
+		return true, nil
+	}
+
+	versions, err := t.sourceHistory(b, sourceFile)
+	if err != nil {
+		return false, fmt.Errorf("getting history of %s: %v", sourceFile, err)
+	}
+	for _, version := range versions {
+		stored, err := t.stored(filePath, version, b.EOL)
+		if err != nil {
+			continue // not a version the sync could have written
+		}
+		if equal, _ := equivalent(b.Compare, current, stored); equal {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// stored content at filePath, as written by content: without keeping any LFS object.
+func (t target) stored(filePath string, content []byte, eol string) ([]byte, error) {
+	if t.attrs.IsLFS(filePath) {
+		pointer, _ := git.NewLFSPointer(content, "")
+		return pointer, nil
+	}
+	return t.attrs.Normalize(filePath, content, eol)
+}
+
+// content to write at filePath from the source file content:
+// - a pointer if the file is tracked by git LFS, the object being kept to be uploaded.
+// - the current target content if equivalent according to the binding comparison.
+// - the content normalized according to the target attributes otherwise.
+func (t target) content(filePath, srcPath string, srcContent []byte, b cfg.FileBinding) ([]byte, error) {
+	if t.attrs.IsLFS(filePath) {
+		pointer, obj := git.NewLFSPointer(srcContent, srcPath)
+		t.lfsObjects[obj.OID] = obj
+		return pointer, nil
+	}
+
+	content, err := t.attrs.Normalize(filePath, srcContent, b.EOL)
+	if err != nil {
+		return nil, err
+	}
+	if b.Compare == "" || b.Compare == cfg.CompareExact {
+		return content, nil
+	}
+	current, exists, err := t.readFile(filePath)
+	if err != nil || !exists {
+		return content, err
+	}
+	equal, err := equivalent(b.Compare, current, content)
+	if err != nil {
+		log.Warnf("comparing %s byte per byte: %v", filePath, err)
+	}
+	if equal {
+		return current, nil
+	}
+	return content, nil
+}
+
+// sortedLFSObjects referenced by the written pointers, by oid.
+func (t target) sortedLFSObjects() []git.LFSObject {
+	objects := make([]git.LFSObject, 0, len(t.lfsObjects))
+	for _, obj := range t.lfsObjects {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].OID < objects[j].OID })
+	return objects
+}
@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"errors"
+	"testing"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/git"
+)
+
+func TestLFSEndpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		lfsConfig map[string][]byte
+		want      string
+		wantAuth  bool
+	}{
+		{name: "repository server", want: "https://github.com/o/r.git/info/lfs", wantAuth: true},
+		{
+			name:      "other server",
+			lfsConfig: map[string][]byte{git.LFSConfigPath: []byte("[lfs]\n\turl = https://lfs.example.com/o/r\n")},
+			want:      "https://lfs.example.com/o/r",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tgt := newTarget(git.Attributes{}, func(filePath string) ([]byte, bool, error) {
+				content, exists := tt.lfsConfig[filePath]
+				return content, exists, nil
+			}, nil)
+			repoURL := "https://github.com/o/r.git"
+			got, err := tgt.lfsEndpoint(repoURL)
+			if err != nil {
+				t.Fatalf("lfsEndpoint() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("lfsEndpoint() = %s, want %s", got, tt.want)
+			}
+			if auth := sameHost(repoURL, got); auth != tt.wantAuth {
+				t.Errorf("sameHost() = %v, want %v", auth, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestKeeps(t *testing.T) {
+	files := map[string][]byte{"a.txt": []byte("local change\n"), "b.txt": []byte("v1\r\n")}
+	history := [][]byte{[]byte("v2\n"), []byte("v1\n")}
+	tests := []struct {
+		name       string
+		filePath   string
+		write      string
+		historyErr error
+		want       bool
+		wantErr    bool
+	}{
+		{name: "default write", filePath: "a.txt"},
+		{name: "always", filePath: "a.txt", write: cfg.WriteAlways},
+		{name: "missing file", filePath: "c.txt", write: cfg.WriteIfMissing},
+		{name: "existing file", filePath: "a.txt", write: cfg.WriteIfMissing, want: true},
+		{name: "unchanged since a past version", filePath: "b.txt", write: cfg.WriteIfUnchanged},
+		{name: "changed in the target", filePath: "a.txt", write: cfg.WriteIfUnchanged, want: true},
+		{name: "missing file unchanged", filePath: "c.txt", write: cfg.WriteIfUnchanged},
+		{name: "history error", filePath: "a.txt", write: cfg.WriteIfUnchanged, historyErr: errors.New("shallow clone"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tgt := newTarget(git.Attributes{}, func(filePath string) ([]byte, bool, error) {
+				content, exists := files[filePath]
+				return content, exists, nil
+			}, func(cfg.FileBinding, string) ([][]byte, error) {
+				return history, tt.historyErr
+			})
+			// the target stores the files with crlf
+			b := cfg.FileBinding{Source: "src", Dest: tt.filePath, Write: tt.write, EOL: git.EOLCRLF}
+			got, err := tgt.keeps(tt.filePath, "src", b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("keeps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("keeps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
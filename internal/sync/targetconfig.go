@@ -0,0 +1,155 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/git"
+	"gha-file-sync/internal/log"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TargetConfigPath of the file letting a target repository control its synchronization, read on its base branch.
+const TargetConfigPath = ".github/file-sync.yml"
+
+// targetConfig of a target repository.
+type targetConfig struct {
+	Sync      *bool    `yaml:"sync"`       // false opts out, true opts in when opting in is required
+	Exclude   []string `yaml:"exclude"`    // destinations of the bindings not to synchronize, glob patterns
+	SourceRef string   `yaml:"source_ref"` // branch, tag or commit of the action repository to take files from
+}
+
+// pinnedSource of the bindings from the action repository, exported at the ref set by the target config.
+type pinnedSource struct {
+	ref        string
+	commitHash string
+	dir        string // removed once synced
+	replaced   string // line of the configured source in the commit message, if any
+}
+
+// withSource recorded in the commit message, if any, in place of the configured source.
+func (s pinnedSource) withSource(commitMsg string) string {
+	if s.ref == "" {
+		return commitMsg
+	}
+	line := fmt.Sprintf("Source pinned by %s: %s (%s)", TargetConfigPath, s.ref, s.commitHash)
+	if s.replaced != "" && strings.Contains(commitMsg, s.replaced) {
+		return strings.Replace(commitMsg, s.replaced, line, 1)
+	}
+	return fmt.Sprintf("%s\n\n%s", commitMsg, line)
+}
+
+// coAuthors of the source files at the pinned commit, in place of the ones of the configured source.
+func (s pinnedSource) coAuthors(src actionSource, bindings []cfg.FileBinding, coAuthors []git.Identity) []git.Identity {
+	if s.ref == "" || !src.coAuthors {
+		return coAuthors
+	}
+	pinnedAuthors, err := git.LastAuthors(src.path, s.commitHash, localSourcePaths(bindings))
+	if err != nil {
+		log.Warnf("-> getting pinned source authors, no co-author will be added: %v", err)
+		return nil
+	}
+	return pinnedAuthors
+}
+
+// clean the exported source.
+func (s pinnedSource) clean() error {
+	if s.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// applyTargetConfig read in the target repository, if it exists, to the bindings:
+// none are kept if the repository opts out, or does not opt in while required,
+// excluded ones are removed and the ones from the action repository are exported at the pinned ref.
+func applyTargetConfig(
+	content []byte, exists, optIn bool,
+	bindings []cfg.FileBinding, src actionSource,
+) ([]cfg.FileBinding, pinnedSource, error) {
+	var tc targetConfig
+	if exists {
+		if err := yaml.Unmarshal(content, &tc); err != nil {
+			return nil, pinnedSource{}, fmt.Errorf("reading %s: %v", TargetConfigPath, err)
+		}
+	}
+
+	switch {
+	case tc.Sync != nil && !*tc.Sync:
+		log.Infof("-> opted out by %s", TargetConfigPath)
+		return nil, pinnedSource{}, nil
+	case optIn && (tc.Sync == nil || !*tc.Sync):
+		log.Infof("-> not opted in by %s", TargetConfigPath)
+		return nil, pinnedSource{}, nil
+	}
+
+	kept := make([]cfg.FileBinding, 0, len(bindings))
+	for _, b := range bindings {
+		excluded, err := isExcluded(b, tc.Exclude)
+		if err != nil {
+			return nil, pinnedSource{}, err
+		}
+		if excluded {
+			log.Infof("-> %s excluded by %s", b, TargetConfigPath)
+			continue
+		}
+		kept = append(kept, b)
+	}
+	if tc.SourceRef == "" {
+		return kept, pinnedSource{}, nil
+	}
+
+	// only the bindings from the action repository are pinned: the other ones have their own ref
+	paths := localSourcePaths(kept)
+	if len(paths) == 0 {
+		return kept, pinnedSource{}, nil
+	}
+	pinned := pinnedSource{ref: tc.SourceRef, dir: src.pinDir, replaced: src.line}
+	if err := pinned.clean(); err != nil {
+		return nil, pinnedSource{}, err
+	}
+	var err error
+	if pinned.commitHash, err = git.ExportSource(src.path, tc.SourceRef, paths, pinned.dir); err != nil {
+		_ = pinned.clean()
+		return nil, pinnedSource{}, fmt.Errorf("exporting source pinned at %s: %v", tc.SourceRef, err)
+	}
+	for i, b := range kept {
+		if b.SourceRepo == nil {
+			kept[i].SourceDir = pinned.dir
+		}
+	}
+	log.Infof("-> source pinned by %s at %s (%s)", TargetConfigPath, pinned.ref, pinned.commitHash)
+	return kept, pinned, nil
+}
+
+// localSourcePaths of the bindings from the action repository, sorted.
+func localSourcePaths(bindings []cfg.FileBinding) []string {
+	paths := []string{}
+	for _, b := range bindings {
+		if b.SourceRepo == nil {
+			paths = append(paths, b.Source)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// isExcluded binding, by its destination.
+func isExcluded(b cfg.FileBinding, patterns []string) (bool, error) {
+	dest := cleanDest(b.Dest)
+	for _, pattern := range patterns {
+		matched, err := path.Match(cleanDest(pattern), dest)
+		if err != nil {
+			return false, fmt.Errorf("invalid exclude pattern %s in %s: %v", pattern, TargetConfigPath, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
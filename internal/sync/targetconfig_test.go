@@ -0,0 +1,184 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/git"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitSource files written in the work tree of the repository at dir, by path, authored by the given name.
+func commitSource(t *testing.T, dir, author string, files map[string]string) string {
+	t.Helper()
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("opening repository: %v", err)
+	}
+	workTree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("getting worktree: %v", err)
+	}
+	for filePath, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, filePath), []byte(content), 0o644); err != nil {
+			t.Fatalf("writing %s: %v", filePath, err)
+		}
+		if _, err := workTree.Add(filePath); err != nil {
+			t.Fatalf("adding %s: %v", filePath, err)
+		}
+	}
+	signature := &object.Signature{Name: author, Email: author + "@example.com", When: time.Now()}
+	hash, err := workTree.Commit("test", &gogit.CommitOptions{Author: signature, Committer: signature})
+	if err != nil {
+		t.Fatalf("committing: %v", err)
+	}
+	return hash.String()
+}
+
+func TestApplyTargetConfig(t *testing.T) {
+	sourceDir := t.TempDir()
+	if _, err := gogit.PlainInit(sourceDir, false); err != nil {
+		t.Fatalf("initing repository: %v", err)
+	}
+	pinnedHash := commitSource(t, sourceDir, "pinned", map[string]string{"a.txt": "pinned"})
+	commitSource(t, sourceDir, "head", map[string]string{"a.txt": "head"})
+
+	remote := &cfg.Repository{Provider: "github", Owner: "o", Name: "src"}
+	bindings := []cfg.FileBinding{
+		{Source: "a.txt", Dest: "a.txt"},
+		{Source: "b.txt", Dest: "docs/b.txt", SourceRepo: remote, SourceDir: "/clone"},
+	}
+	tests := []struct {
+		name       string
+		content    string
+		exists     bool
+		optIn      bool
+		wantDests  []string
+		wantPinned bool
+		wantErr    bool
+	}{
+		{name: "no config", wantDests: []string{"a.txt", "docs/b.txt"}},
+		{name: "opted out", content: "sync: false\n", exists: true, wantDests: []string{}},
+		{name: "opt in required", optIn: true, wantDests: []string{}},
+		{name: "opted in", content: "sync: true\n", exists: true, optIn: true, wantDests: []string{"a.txt", "docs/b.txt"}},
+		{name: "excluded", content: "exclude: [\"docs/*\"]\n", exists: true, wantDests: []string{"a.txt"}},
+		{name: "invalid exclude", content: "exclude: [\"[\"]\n", exists: true, wantErr: true},
+		{name: "invalid config", content: "sync: [\n", exists: true, wantErr: true},
+		{
+			name: "pinned", content: "source_ref: " + pinnedHash + "\n", exists: true,
+			wantDests: []string{"a.txt", "docs/b.txt"}, wantPinned: true,
+		},
+		{name: "missing pinned ref", content: "source_ref: missing\n", exists: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := actionSource{
+				path:      sourceDir,
+				line:      sourceLine("main", "head"),
+				pinDir:    filepath.Join(t.TempDir(), "pinned"),
+				coAuthors: true,
+			}
+			kept, pinned, err := applyTargetConfig([]byte(tt.content), tt.exists, tt.optIn, bindings, src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyTargetConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, statErr := os.Stat(src.pinDir); statErr == nil {
+					t.Errorf("pinned source left in %s", src.pinDir)
+				}
+				return
+			}
+			dests := []string{}
+			for _, b := range kept {
+				dests = append(dests, b.Dest)
+			}
+			if !reflect.DeepEqual(dests, tt.wantDests) {
+				t.Errorf("applyTargetConfig() kept %v, want %v", dests, tt.wantDests)
+			}
+			if (pinned.ref != "") != tt.wantPinned {
+				t.Fatalf("applyTargetConfig() pinned %+v, want pinned %v", pinned, tt.wantPinned)
+			}
+			if !tt.wantPinned {
+				return
+			}
+			defer pinned.clean() //nolint:errcheck
+
+			if kept[0].SourceDir != src.pinDir || kept[1].SourceDir != "/clone" {
+				t.Errorf("source dirs = %s, %s, want %s, /clone", kept[0].SourceDir, kept[1].SourceDir, src.pinDir)
+			}
+			content, err := os.ReadFile(kept[0].SourcePath(sourceDir))
+			if err != nil || string(content) != "pinned" {
+				t.Errorf("pinned source content = %q, %v, want %q", content, err, "pinned")
+			}
+			authors := pinned.coAuthors(src, kept, []git.Identity{{Name: "head", Email: "head@example.com"}})
+			if want := []git.Identity{{Name: "pinned", Email: "pinned@example.com"}}; !reflect.DeepEqual(authors, want) {
+				t.Errorf("coAuthors() = %v, want %v", authors, want)
+			}
+		})
+	}
+}
+
+func TestWithSource(t *testing.T) {
+	pinnedLine := "Source pinned by " + TargetConfigPath + ": v1 (abc)"
+	tests := []struct {
+		name      string
+		pinned    pinnedSource
+		commitMsg string
+		want      string
+	}{
+		{name: "not pinned", commitMsg: "sync\n\nSource: main (def)", want: "sync\n\nSource: main (def)"},
+		{
+			name:      "configured source replaced",
+			pinned:    pinnedSource{ref: "v1", commitHash: "abc", replaced: sourceLine("main", "def")},
+			commitMsg: "sync\n\nSource: main (def)\nSource: github:o/r@v2 (123)",
+			want:      "sync\n\n" + pinnedLine + "\nSource: github:o/r@v2 (123)",
+		},
+		{
+			name:      "work tree source",
+			pinned:    pinnedSource{ref: "v1", commitHash: "abc"},
+			commitMsg: "sync",
+			want:      "sync\n\n" + pinnedLine,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pinned.withSource(tt.commitMsg); got != tt.want {
+				t.Errorf("withSource() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsExcluded(t *testing.T) {
+	tests := []struct {
+		name     string
+		dest     string
+		patterns []string
+		want     bool
+		wantErr  bool
+	}{
+		{name: "no pattern", dest: "a.txt"},
+		{name: "exact", dest: "a.txt", patterns: []string{"a.txt"}, want: true},
+		{name: "glob", dest: "docs/a.md", patterns: []string{"b.txt", "docs/*.md"}, want: true},
+		{name: "leading slash", dest: "/docs/a.md", patterns: []string{"./docs/a.md"}, want: true},
+		{name: "glob does not cross directories", dest: "docs/sub/a.md", patterns: []string{"docs/*"}},
+		{name: "invalid pattern", dest: "a.txt", patterns: []string{"["}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := isExcluded(cfg.FileBinding{Source: "src", Dest: tt.dest}, tt.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("isExcluded() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("isExcluded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
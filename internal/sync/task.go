@@ -2,19 +2,22 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path"
 	"regexp"
-	"time"
+	"strings"
 
+	"gha-file-sync/internal/cfg"
 	"gha-file-sync/internal/git"
-	"gha-file-sync/internal/github"
 	"gha-file-sync/internal/log"
+	"gha-file-sync/internal/provider"
 
-	cp "github.com/otiai10/copy"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 )
 
-// Task is a handler which synchronizes a git repository files on github with current filesystem and given rules called file bindings.
+// Task is a handler which synchronizes a git repository files on a git hosting provider with current filesystem and given rules called file bindings.
 type Task struct {
 	// repo config
 	repoName string
@@ -24,20 +27,37 @@ type Task struct {
 	sourcePath string
 	targetPath string
 
-	// github config
-	ghHostURL string
-	ghToken   string
-	ghClient  *github.Client
+	// provider config
+	provider provider.Provider
 
 	// git config
 	gitRepo *git.Repository
 
 	// additional config
 	fileSyncBranchRegexp *regexp.Regexp
-	fileBindings         map[string]string
+	fileBindings         []cfg.FileBinding
+	syncMode             string
+	pushBranch           string
+	commitSigning        string
+	commitTrailers       []string
+	// apiAuthor and apiCommitter of the commits via api: only set if overridden
+	apiAuthor, apiCommitter *git.Identity
 
 	// internal state
 
+	// pinned source set by the target config, if any
+	pinned pinnedSource
+
+	// lfsObjects referenced by the copied files, to upload before pushing to the lfsEndpoint
+	lfsObjects  []git.LFSObject
+	lfsEndpoint string
+
+	// patchReports of the patch bindings, recorded in the commit message
+	patchReports []string
+
+	// isNewBranch indicates if the sync branch does not exist yet on the remote
+	isNewBranch bool
+
 	// existingPRNumber indicates if a PR and a branch should be created, and what is the existing PR number
 	// there is no distinction between the PR & the branch for now:
 	// it is set based on opened PR: if a sync branch exists without a PR, it is either ignored or results in an error
@@ -48,87 +68,132 @@ type Task struct {
 // One task per repository.
 func NewTask(
 	ctx context.Context,
-	owner, repoName,
-	baseSourcePath, baseTargetPath,
-	ghURL, ghToken string,
-	ghClient *github.Client,
+	owner, repoName string,
+	source actionSource, baseTargetPath string,
+	p provider.Provider,
+	repoURL string, gitAuth transport.AuthMethod,
 	fileSyncBranchRegexpStr string,
-	fileBindings map[string]string,
+	fileBindings []cfg.FileBinding, targetOptIn bool,
+	syncMode, pushBranch string,
+	commitSigning string, commitSigner gogit.Signer,
+	authorOverride, committerOverride git.Identity,
+	signOff bool, coAuthors []git.Identity,
+	cloneOpt git.CloneOptions,
 ) (t Task, err error) {
 	// init the repo RepositoryManager
 	t = Task{
 		repoName: repoName,
 		owner:    owner,
 
-		sourcePath: baseSourcePath,
+		sourcePath: source.path,
 		targetPath: path.Join(baseTargetPath, owner, repoName),
 
-		ghHostURL: ghURL,
-		ghToken:   ghToken,
-		ghClient:  ghClient,
+		provider: p,
 
 		fileSyncBranchRegexp: regexp.MustCompile(fileSyncBranchRegexpStr),
 		fileBindings:         fileBindings,
+		syncMode:             syncMode,
+		pushBranch:           pushBranch,
+		commitSigning:        commitSigning,
 
 		existingPRNumber: nil, // by default, consider creating a new PR
 	}
 
 	// add to the repo RepositoryManager the author information
-	authorName, err := ghClient.GetAuthenticatedUsername(ctx)
+	// the configured identity prevails on the authenticated user one
+	author, err := p.GetAuthenticatedUser(ctx)
 	if err != nil {
 		return t, err
 	}
-	defaultBranchName := fmt.Sprintf("%s-sync-file-pr", time.Now().Format("2006-01-02"))
+	author = author.Override(authorOverride)
+	committer := author.Override(committerOverride)
+	if author.Email == "" {
+		log.Warnf("no e-mail found for the commit author %s", author.Name)
+	}
+	t.apiAuthor, t.apiCommitter = apiIdentities(author, committer, authorOverride, committerOverride)
+
 	t.gitRepo, err = git.NewRepository(
 		ctx,
 		t.targetPath,
-		github.GetRepoURL(t.ghHostURL, t.owner, t.repoName), defaultBranchName,
-		github.GetBasicAuth(t.ghToken), authorName,
+		repoURL, defaultSyncBranchName(),
+		gitAuth, author, committer,
+		cloneOpt,
 	)
-	return t, err
+	if err != nil {
+		return t, err
+	}
+	t.gitRepo.SetSigner(commitSigner)
+
+	// the target repository controls its synchronization from its base branch, just cloned
+	content, exists, err := t.gitRepo.ReadHeadFile(TargetConfigPath)
+	if err == nil {
+		t.fileBindings, t.pinned, err = applyTargetConfig(content, exists, targetOptIn, fileBindings, source)
+	}
+	if err != nil {
+		_ = t.gitRepo.Clean()
+		return t, err
+	}
+	t.commitTrailers = commitTrailers(author, signOff, t.pinned.coAuthors(source, t.fileBindings, coAuthors))
+	return t, nil
 }
 
 // PickSyncBranch on the repo which will be used to compare files and push potential changes
 // could be:
-// - a new branch based on the repo's HEAD: probably main or master.
+// - a new branch based on the repo's HEAD: its default branch.
 // - an existing file sync branch.
+// - the base branch itself, in direct mode.
 func (t *Task) PickSyncBranch(ctx context.Context) error {
-	// try to find an existing file sync branch by checking opened PRs
-	branchNameByPRNumbers, err := t.ghClient.GetHeadBranchNameByPRNumbers(ctx, t.owner, t.repoName)
-	if err != nil {
-		return fmt.Errorf("getting branches: %v", err)
-	}
-
-	// try to find an existing file sync PR
-	alreadyFound := false
-	for prNumber, branchName := range branchNameByPRNumbers {
-		// use branch name to see if it is an file sync PR
-		// skip it if it doesn't match
-		if !t.fileSyncBranchRegexp.MatchString(branchName) {
-			continue
+	// direct mode: the base branch is the sync branch
+	if t.syncMode == cfg.SyncModeDirect {
+		if err := t.gitRepo.SetupLocalBaseBranch(); err != nil {
+			return fmt.Errorf("setting up base branch locally: %v", err)
 		}
+		return nil
+	}
 
-		// if any sync PR was already found, raise a warning about it, keep the first one found by breaking the loop
-		if alreadyFound {
-			log.Warnf("it seems there are two existing file sync pull requests on repo %s", t.repoName)
-			break
-		}
-		// set the existing sync branch and existing PR
-		t.gitRepo.SetSyncBranchName(branchName)
-		t.existingPRNumber = new(int)
-		*t.existingPRNumber = prNumber
-
-		alreadyFound = true
+	var err error
+	if t.syncMode == cfg.SyncModePush {
+		t.isNewBranch, err = t.pickRemoteSyncBranch(ctx)
+	} else {
+		t.isNewBranch, err = t.pickPRSyncBranch(ctx)
+	}
+	if err != nil {
+		return err
 	}
 
 	// configure the branch locally
-	isNewBranch := (t.existingPRNumber == nil)
-	if err := t.gitRepo.SetupLocalSyncBranch(isNewBranch); err != nil {
+	if err := t.gitRepo.SetupLocalSyncBranch(ctx, t.isNewBranch); err != nil {
 		return fmt.Errorf("setting up sync branch locally: %v", err)
 	}
 	return nil
 }
 
+// pickPRSyncBranch by checking opened PRs: the sync branch is the head branch of an existing file sync PR.
+func (t *Task) pickPRSyncBranch(ctx context.Context) (isNewBranch bool, err error) {
+	branchName, prNumber, err := findPRSyncBranch(ctx, t.provider, t.owner, t.repoName, t.fileSyncBranchRegexp)
+	if err != nil {
+		return false, err
+	}
+	if prNumber != nil {
+		t.gitRepo.SetSyncBranchName(branchName)
+		t.existingPRNumber = prNumber
+	}
+	return (t.existingPRNumber == nil), nil
+}
+
+// pickRemoteSyncBranch by listing remote branches, without relying on any hosting api.
+func (t *Task) pickRemoteSyncBranch(ctx context.Context) (isNewBranch bool, err error) {
+	branchNames, err := t.gitRepo.ListRemoteBranchNames(ctx)
+	if err != nil {
+		return false, fmt.Errorf("getting branches: %v", err)
+	}
+	branchName, isNewBranch := findRemoteSyncBranch(branchNames, t.pushBranch, t.fileSyncBranchRegexp, t.repoName)
+	if branchName != "" {
+		t.gitRepo.SetSyncBranchName(branchName)
+	}
+	return isNewBranch, nil
+}
+
 // HasChangedAfterCopy first updates local files following binding rules,
 // then checks the git status and returns true if something has changed.
 func (t *Task) HasChangedAfterCopy(ctx context.Context) (bool, error) {
@@ -142,16 +207,29 @@ func (t *Task) HasChangedAfterCopy(ctx context.Context) (bool, error) {
 		return false, fmt.Errorf("local git repo is not setup correctly")
 	}
 
+	// 1. keep the bindings whose conditions are met by the target repo, on its base branch as its config
+	filePaths, err := t.gitRepo.ListBaseFiles()
+	if err != nil {
+		return false, err
+	}
+	bindings := applicableBindings(t.fileBindings, newTargetRepo(ctx, t.provider, t.owner, t.repoName, filePaths))
+	if len(bindings) == 0 {
+		return false, nil
+	}
+
+	// files are written as git stores them in the target repo, not to be seen as changed otherwise
+	attrs, err := t.gitRepo.GetAttributes()
+	if err != nil {
+		return false, err
+	}
+	tgt := newTarget(attrs, t.gitRepo.ReadHeadFile, sourceHistory(t.sourcePath))
+
 	// 2. copy files from the current repo to the repo-to-sync local path
 	// according to configured bindings
 	notAnyCopySuccess := true
-	for src, dest := range t.fileBindings {
-		// build absolute path to copy
-		src = path.Join(t.sourcePath, src)
-		dest = path.Join(t.targetPath, dest)
-
-		if err := cp.Copy(src, dest); err != nil {
-			log.Errorf("copying %s to %s: %v", src, dest, err)
+	for _, b := range bindings {
+		if err := copyBinding(t.sourcePath, t.targetPath, b, tgt); err != nil {
+			log.Errorf("copying %s to %s: %v", b.Source, b.Dest, err)
 			continue
 		}
 
@@ -160,20 +238,46 @@ func (t *Task) HasChangedAfterCopy(ctx context.Context) (bool, error) {
 	if notAnyCopySuccess {
 		return false, fmt.Errorf("not able to copy any file")
 	}
+	t.lfsObjects = tgt.sortedLFSObjects()
+	t.patchReports = tgt.sortedPatchReports()
+	if len(t.lfsObjects) > 0 {
+		if t.lfsEndpoint, err = tgt.lfsEndpoint(t.provider.GetRepoURL(t.owner, t.repoName)); err != nil {
+			return false, err
+		}
+	}
 
 	// 3. consider if files have changed
 	return t.gitRepo.ChangeDetected()
 }
 
 func (t *Task) UpdateRemote(ctx context.Context, commitMsg, prTitle string) error {
-	if err := t.gitRepo.AddCommitPush(ctx, commitMsg); err != nil {
+	// never force push on the base branch nor a fixed push branch: it fails if the branch has moved since the clone
+	isDirect := (t.syncMode == cfg.SyncModeDirect)
+	force := isForcePushed(t.syncMode, t.pushBranch)
+	// the pushed pointers must reference existing objects
+	if err := uploadLFSObjects(ctx, t.provider, t.owner, t.repoName, t.lfsEndpoint, t.lfsObjects); err != nil {
 		return err
 	}
+	// trailers are only added to the commit: the PR description keeps the bare message
+	commitMsg = withPatchReports(t.pinned.withSource(commitMsg), t.patchReports)
+	fullCommitMsg := withTrailers(commitMsg, t.commitTrailers)
+	if t.commitSigning == cfg.CommitSigningAPI {
+		if err := t.commitViaAPI(ctx, fullCommitMsg, force); err != nil {
+			return err
+		}
+	} else if err := t.gitRepo.AddCommitPush(ctx, fullCommitMsg, force); err != nil {
+		return err
+	}
+	// push and direct modes: the branch is the only expected result
+	if t.syncMode == cfg.SyncModePush || isDirect {
+		log.Infof("branch pushed: %s", t.gitRepo.GetSyncBranchName())
+		return nil
+	}
 	baseBranchName, err := t.gitRepo.GetBaseBranchName()
 	if err != nil {
 		return err
 	}
-	if err := t.ghClient.CreateOrUpdatePR(
+	if err := t.provider.CreateOrUpdatePR(
 		ctx, t.existingPRNumber,
 		t.owner, t.repoName,
 		baseBranchName, t.gitRepo.GetSyncBranchName(),
@@ -184,6 +288,61 @@ func (t *Task) UpdateRemote(ctx context.Context, commitMsg, prTitle string) erro
 	return nil
 }
 
+// commitTrailers crediting the co-authors, except the author itself, then signing off for the author if required.
+func commitTrailers(author git.Identity, signOff bool, coAuthors []git.Identity) []string {
+	trailers := []string{}
+	for _, coAuthor := range coAuthors {
+		if strings.EqualFold(coAuthor.Email, author.Email) {
+			continue
+		}
+		trailers = append(trailers, fmt.Sprintf("Co-authored-by: %s", coAuthor))
+	}
+	if signOff {
+		trailers = append(trailers, fmt.Sprintf("Signed-off-by: %s", author))
+	}
+	return trailers
+}
+
+// apiIdentities of the commits via api: none unless an identity is overridden,
+// for the provider to author the commits with the authenticated user and sign them.
+func apiIdentities(author, committer, authorOverride, committerOverride git.Identity) (*git.Identity, *git.Identity) {
+	if authorOverride == (git.Identity{}) && committerOverride == (git.Identity{}) {
+		return nil, nil
+	}
+	return &author, &committer
+}
+
+// withTrailers appended to the commit message, separated by a blank line.
+func withTrailers(commitMsg string, trailers []string) string {
+	if len(trailers) == 0 {
+		return commitMsg
+	}
+	return fmt.Sprintf("%s\n\n%s", commitMsg, strings.Join(trailers, "\n"))
+}
+
+// commitViaAPI the local changes with the provider api instead of pushing a local commit.
+func (t *Task) commitViaAPI(ctx context.Context, commitMsg string, force bool) error {
+	committer, ok := t.provider.(provider.APICommitter)
+	if !ok {
+		return fmt.Errorf("committing via api: %w", provider.ErrNotSupported)
+	}
+	headHash, changes, err := t.gitRepo.GetChanges()
+	if err != nil {
+		return err
+	}
+	return committer.CommitViaAPI(
+		ctx,
+		t.owner, t.repoName, t.gitRepo.GetSyncBranchName(), headHash, commitMsg,
+		t.apiAuthor, t.apiCommitter,
+		changes,
+		t.isNewBranch, force,
+	)
+}
+
+// CleanAll removes the pinned source, if any, and the clone or releases it when cached:
+// both are always cleaned, the clone lock would be kept otherwise.
 func (t *Task) CleanAll(ctx context.Context) error {
-	return t.gitRepo.Clean()
+	pinnedErr := t.pinned.clean()
+	repoErr := t.gitRepo.Clean()
+	return errors.Join(pinnedErr, repoErr)
 }
@@ -0,0 +1,68 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+
+	"gha-file-sync/internal/git"
+)
+
+func TestCommitTrailers(t *testing.T) {
+	author := git.Identity{Name: "bot", Email: "bot@example.com"}
+	coAuthor := git.Identity{Name: "dev", Email: "dev@example.com"}
+	tests := []struct {
+		name      string
+		signOff   bool
+		coAuthors []git.Identity
+		want      []string
+	}{
+		{name: "none", want: []string{}},
+		{name: "sign off", signOff: true, want: []string{"Signed-off-by: bot <bot@example.com>"}},
+		{
+			name: "co-authors without the author", signOff: true, coAuthors: []git.Identity{coAuthor, author},
+			want: []string{"Co-authored-by: dev <dev@example.com>", "Signed-off-by: bot <bot@example.com>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commitTrailers(author, tt.signOff, tt.coAuthors); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commitTrailers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIIdentities(t *testing.T) {
+	user := git.Identity{Name: "bot", Email: "bot@example.com"}
+	tests := []struct {
+		name              string
+		authorOverride    git.Identity
+		committerOverride git.Identity
+		wantAuthor        *git.Identity
+		wantCommitter     *git.Identity
+	}{
+		{name: "not overridden"},
+		{
+			name:           "author overridden",
+			authorOverride: git.Identity{Name: "team"},
+			wantAuthor:     &git.Identity{Name: "team", Email: "bot@example.com"},
+			wantCommitter:  &git.Identity{Name: "team", Email: "bot@example.com"},
+		},
+		{
+			name:              "committer overridden",
+			committerOverride: git.Identity{Email: "ci@example.com"},
+			wantAuthor:        &user,
+			wantCommitter:     &git.Identity{Name: "bot", Email: "ci@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			author := user.Override(tt.authorOverride)
+			committer := author.Override(tt.committerOverride)
+			gotAuthor, gotCommitter := apiIdentities(author, committer, tt.authorOverride, tt.committerOverride)
+			if !reflect.DeepEqual(gotAuthor, tt.wantAuthor) || !reflect.DeepEqual(gotCommitter, tt.wantCommitter) {
+				t.Errorf("apiIdentities() = %v, %v, want %v, %v", gotAuthor, gotCommitter, tt.wantAuthor, tt.wantCommitter)
+			}
+		})
+	}
+}
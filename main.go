@@ -2,11 +2,21 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
 
+	"gha-file-sync/internal/azure"
+	"gha-file-sync/internal/bitbucket"
 	"gha-file-sync/internal/cfg"
+	"gha-file-sync/internal/git"
+	"gha-file-sync/internal/gitea"
 	"gha-file-sync/internal/github"
+	"gha-file-sync/internal/gitlab"
 	"gha-file-sync/internal/log"
+	"gha-file-sync/internal/plaingit"
+	"gha-file-sync/internal/provider"
 	"gha-file-sync/internal/sync"
 )
 
@@ -25,19 +35,162 @@ func main() {
 	}
 	config.Print()
 
-	// init of github client
-	ghClient, err := github.NewClient(ctx, config.GithubToken)
+	// init of providers clients
+	providers, err := initProviders(ctx, config)
 	if err != nil {
-		log.Errorf("initing github client: %v", err)
+		log.Errorf("initing providers: %v", err)
 		os.Exit(1)
 	}
 
+	// repositories discovered by selectors
+	if err := discoverRepositories(ctx, config, providers); err != nil {
+		log.Errorf("discovering repositories: %v", err)
+		os.Exit(1)
+	}
+
+	// sources at a given ref or from other repositories
+	if err := sync.PrepareSources(ctx, config, providers); err != nil {
+		log.Errorf("preparing sources: %v", err)
+		_ = sync.CleanSources(config)
+		os.Exit(1)
+	}
+	defer func() {
+		if err := sync.CleanSources(config); err != nil {
+			log.Errorf("cleaning sources: %v", err)
+		}
+	}()
+
+	// authors of the source files, credited on the sync commits
+	var coAuthors []git.Identity
+	if config.CommitCoAuthors {
+		sourcePaths := make([]string, 0, len(config.FilesBindings))
+		for _, b := range config.FilesBindings {
+			// only the action repository history is known
+			if b.SourceRepo == nil {
+				sourcePaths = append(sourcePaths, b.Source)
+			}
+		}
+		sort.Strings(sourcePaths)
+		if coAuthors, err = git.LastAuthors(config.FileSourcePath, config.SourceRef, sourcePaths); err != nil {
+			log.Warnf("getting source authors, no co-author will be added: %v", err)
+		}
+	}
+
 	// start synchronization
 	log.Infof("Let's sync")
-	for _, repoName := range config.RepositoryNames {
-		if err := sync.Do(ctx, repoName, config, ghClient); err != nil {
-			log.Errorf("syncing %s: %v", repoName, err)
+	for _, repo := range config.Repositories {
+		if err := sync.Do(ctx, repo, config, providers, coAuthors); err != nil {
+			log.Errorf("syncing %s: %v", repo, err)
 		}
 	}
 	log.Infof("Sync finished.")
+
+	// keep the clone cache under its max size
+	if config.CloneCacheDir != "" && config.CloneCacheMaxSize > 0 {
+		if err := git.EvictCache(config.CloneCacheDir, config.CloneCacheMaxSize); err != nil {
+			log.Errorf("evicting cached clones: %v", err)
+		}
+	}
+}
+
+// discoverRepositories matching the selectors, added to the repositories to synchronize if not listed yet.
+func discoverRepositories(ctx context.Context, config *cfg.Config, providers provider.Registry) error {
+	// github names are case insensitive: a listed repository may differ in case from the configured one
+	known := make(map[string]bool, len(config.Repositories))
+	for _, repo := range config.Repositories {
+		known[strings.ToLower(repo.String())] = true
+	}
+	for _, selector := range config.RepositorySelectors {
+		p, err := providers.Get(ctx, provider.GitHub, selector.Owner)
+		if err != nil {
+			return err
+		}
+		lister, ok := p.(provider.RepositoryLister)
+		if !ok {
+			return fmt.Errorf("provider %s cannot list repositories", provider.GitHub)
+		}
+		infos, err := lister.ListRepositories(ctx, selector.Owner)
+		if err != nil {
+			return err
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+		count := 0
+		for _, info := range infos {
+			repo := cfg.Repository{Provider: provider.GitHub, Owner: info.Owner, Name: info.Name}
+			key := strings.ToLower(repo.String())
+			if !selector.Matches(info) || known[key] {
+				continue
+			}
+			known[key] = true
+			config.Repositories = append(config.Repositories, repo)
+			log.Infof("discovered %s", repo)
+			count++
+		}
+		log.Infof("%d repositories discovered by %s", count, selector)
+	}
+	return nil
+}
+
+// initProviders creates a client for each provider having a credential configured.
+func initProviders(ctx context.Context, config *cfg.Config) (provider.Registry, error) {
+	providers := make(provider.Registry)
+
+	// github
+	var ghClient *github.Client
+	var err error
+	switch {
+	case config.GithubAppID != 0:
+		ghClient, err = github.NewAppClient(
+			ctx,
+			config.GithubAppID, config.GithubAppInstallationID, config.GithubAppPrivateKey,
+			config.GithubURL, config.GithubAPIURL, config.GithubUploadURL,
+		)
+	case config.GithubToken != "":
+		ghClient, err = github.NewClient(ctx, config.GithubToken, config.GithubURL, config.GithubAPIURL, config.GithubUploadURL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("initing github client: %v", err)
+	}
+	if ghClient != nil {
+		providers[provider.GitHub] = ghClient
+	}
+
+	// gitlab
+	if config.GitlabToken != "" {
+		glClient, err := gitlab.NewClient(config.GitlabToken, config.GitlabURL)
+		if err != nil {
+			return nil, fmt.Errorf("initing gitlab client: %v", err)
+		}
+		providers[provider.GitLab] = glClient
+	}
+
+	// gitea
+	if config.GiteaToken != "" && config.GiteaURL != "" {
+		giteaClient, err := gitea.NewClient(ctx, config.GiteaToken, config.GiteaURL)
+		if err != nil {
+			return nil, fmt.Errorf("initing gitea client: %v", err)
+		}
+		providers[provider.Gitea] = giteaClient
+	}
+
+	// bitbucket
+	if config.BitbucketToken != "" {
+		providers[provider.Bitbucket] = bitbucket.NewClient(config.BitbucketUsername, config.BitbucketToken, config.BitbucketURL)
+	}
+
+	// azure devops
+	if config.AzureDevOpsToken != "" && config.AzureDevOpsURL != "" {
+		azureClient, err := azure.NewClient(ctx, config.AzureDevOpsToken, config.AzureDevOpsURL)
+		if err != nil {
+			return nil, fmt.Errorf("initing azure devops client: %v", err)
+		}
+		providers[provider.Azure] = azureClient
+	}
+
+	// plain git
+	if config.GitURL != "" {
+		providers[provider.Git] = plaingit.NewClient(config.GitURL, config.GitUsername, config.GitPassword, config.GitAuthorName)
+	}
+	return providers, nil
 }